@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
 	"os"
 	"os/signal"
@@ -57,7 +58,19 @@ func main() {
 
 	// инициализация слоев приложения
 	queries := db.New(pool)
-	svc := service.NewService(queries)
+	opts := []service.Option{
+		service.WithMaxReviewers(cfg.MaxReviewers),
+		service.WithEscalationDepth(cfg.EscalationDepth),
+	}
+	if cfg.PairingWindow != nil {
+		opts = append(opts, service.WithPairingWindow(*cfg.PairingWindow))
+	}
+	if cfg.Seed != nil {
+		// воспроизводимые назначения (тесты, разбор инцидентов)
+		log.Info().Uint64("seed", *cfg.Seed).Msg("using fixed seed for reviewer selection")
+		opts = append(opts, service.WithRandSource(rand.NewPCG(*cfg.Seed, *cfg.Seed)))
+	}
+	svc := service.NewService(queries, opts...)
 	h := handler.NewHandler(svc, &log.Logger)
 
 	// настройка HTTP сервера
@@ -65,22 +78,51 @@ func main() {
 
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Logger)
+	r.Use(h.Actor)
 
 	// --- Teams ---
 	r.Post("/team/add", h.CreateTeamWithMembers)
 	r.Get("/team/get", h.GetTeam)
+	r.Get("/team/settings", h.GetTeamSettings)
+	r.Post("/team/settings", h.UpdateTeamSettings)
+	r.Post("/team/deactivate", h.DeactivateTeam)
+	r.Post("/team/setParent", h.SetTeamParent)
+	r.Post("/team/addMember", h.AddTeamMember)
+	r.Post("/team/removeMember", h.RemoveTeamMember)
+
+	// --- Code ownership ---
+	r.Get("/ownership/get", h.GetOwnershipRules)
+	r.Post("/ownership/set", h.SetOwnershipRules)
 
 	// --- Users  ---
 	r.Post("/users/setIsActive", h.SetUserActiveStatus)
+	r.Post("/users/setSkills", h.SetUserSkills)
+	r.Post("/users/setMaxOpenReviews", h.SetUserMaxOpenReviews)
+	r.Post("/users/setSeniority", h.SetUserSeniority)
+	r.Post("/users/setPrimaryTeam", h.SetPrimaryTeam)
+	r.Post("/users/addAbsence", h.AddAbsence)
+	r.Get("/users/getAbsences", h.GetAbsences)
+	r.Post("/users/deleteAbsence", h.DeleteAbsence)
 	r.Get("/users/getReview", h.GetPRsForUser)
 
 	// --- Pull Requests ---
 	r.Post("/pullRequest/create", h.CreatePullRequest)
+	r.Get("/pullRequest/get", h.GetPullRequest)
+	r.Get("/pullRequest/timeline", h.GetPRTimeline)
+	r.Post("/pullRequest/preview", h.PreviewPullRequest)
+	r.Post("/pullRequest/ready", h.MarkPullRequestReady)
 	r.Post("/pullRequest/merge", h.MergePullRequest)
+	r.Post("/pullRequest/close", h.ClosePullRequest)
+	r.Post("/pullRequest/reopen", h.ReopenPullRequest)
 	r.Post("/pullRequest/reassign", h.ReassignReviewer)
+	r.Post("/pullRequest/addReviewer", h.AddReviewer)
+	r.Post("/pullRequest/removeReviewer", h.RemoveReviewer)
+	r.Post("/pullRequest/review", h.SubmitReview)
+	r.Get("/pullRequest/understaffed", h.GetUnderstaffedPRs)
 
 	// --- Stats ---
 	r.Get("/stats/assignments", h.GetAssignmentStats)
+	r.Get("/stats/pairs", h.GetPairStats)
 
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		log.Info().Msg("hello, world endpoint was called")
@@ -95,6 +137,11 @@ func main() {
 		Handler: r,
 	}
 
+	// фоновая задача: переназначение ревью тех, у кого началось отсутствие
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go runAbsenceJob(jobCtx, svc, cfg.AbsenceCheckInterval)
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("server failed to start")
@@ -117,3 +164,34 @@ func main() {
 
 	log.Info().Msg("server shutdown complete")
 }
+
+// периодически обрабатывает начавшиеся и закончившиеся отсутствия до отмены ctx
+func runAbsenceJob(ctx context.Context, svc *service.Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reassigned, notReassigned, err := svc.ProcessStartedAbsences(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to process started absences")
+				continue
+			}
+			if len(reassigned) > 0 || len(notReassigned) > 0 {
+				log.Info().Msgf("absences processed: %d reviews reassigned, %d left without replacement", len(reassigned), len(notReassigned))
+			}
+
+			toppedUp, err := svc.ProcessEndedAbsences(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to process ended absences")
+				continue
+			}
+			if len(toppedUp) > 0 {
+				log.Info().Msgf("ended absences processed: %d pull requests topped up", len(toppedUp))
+			}
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/caarlos0/env/v10"
 	"github.com/rs/zerolog/log"
 )
@@ -10,6 +12,22 @@ type Config struct {
 	Port        string `env:"PORT" envDefault:"8080"`
 	DatabaseURL string `env:"DATABASE_URL,required"`
 	LogLevel    string `env:"LOG_LEVEL" envDefault:"INFO"`
+
+	// верхняя граница числа ревьюверов на один PR (для настроек команд и запросов)
+	MaxReviewers int `env:"MAX_REVIEWERS" envDefault:"5"`
+
+	// как часто проверять начавшиеся отсутствия и переназначать ревью
+	AbsenceCheckInterval time.Duration `env:"ABSENCE_CHECK_INTERVAL" envDefault:"1m"`
+
+	// seed для выбора ревьюверов: с ним назначения воспроизводимы; без него - случайны
+	Seed *uint64 `env:"SEED"`
+
+	// за какой период повторные пары автор -> ревьювер понижают приоритет кандидата (0 - не учитывать);
+	// без него - service.DefaultPairingWindow
+	PairingWindow *time.Duration `env:"PAIRING_WINDOW"`
+
+	// на сколько уровней вверх по дереву команд искать ревьюверов после резервных команд (0 - не искать)
+	EscalationDepth int `env:"ESCALATION_DEPTH" envDefault:"1"`
 }
 
 func NewConfig() (*Config, error) {
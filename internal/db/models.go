@@ -17,6 +17,8 @@ type PrStatus string
 const (
 	PrStatusOPEN   PrStatus = "OPEN"
 	PrStatusMERGED PrStatus = "MERGED"
+	PrStatusDRAFT  PrStatus = "DRAFT"
+	PrStatusCLOSED PrStatus = "CLOSED"
 )
 
 func (e *PrStatus) Scan(src interface{}) error {
@@ -54,28 +56,113 @@ func (ns NullPrStatus) Value() (driver.Value, error) {
 	return string(ns.PrStatus), nil
 }
 
+type OwnershipRule struct {
+	TeamID     pgtype.UUID `json:"team_id"`
+	Repository pgtype.Text `json:"repository"`
+	Position   int32       `json:"position"`
+	Pattern    string      `json:"pattern"`
+	OwnerIds   []uuid.UUID `json:"owner_ids"`
+}
+
+type PrAssignment struct {
+	ID             uuid.UUID          `json:"id"`
+	PrID           uuid.UUID          `json:"pr_id"`
+	UserID         uuid.UUID          `json:"user_id"`
+	Reason         string             `json:"reason"`
+	ReplacedUserID pgtype.UUID        `json:"replaced_user_id"`
+	TeamID         pgtype.UUID        `json:"team_id"`
+	Strategy       pgtype.Text        `json:"strategy"`
+	Inputs         []byte             `json:"inputs"`
+	AssignedAt     pgtype.Timestamptz `json:"assigned_at"`
+	RemovedAt      pgtype.Timestamptz `json:"removed_at"`
+}
+
+type PrEvent struct {
+	ID             int64              `json:"id"`
+	PrID           uuid.UUID          `json:"pr_id"`
+	EventType      string             `json:"event_type"`
+	ActorID        pgtype.UUID        `json:"actor_id"`
+	UserID         pgtype.UUID        `json:"user_id"`
+	ReplacedUserID pgtype.UUID        `json:"replaced_user_id"`
+	FromStatus     pgtype.Text        `json:"from_status"`
+	ToStatus       pgtype.Text        `json:"to_status"`
+	Details        []byte             `json:"details"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	ActorKind      string             `json:"actor_kind"`
+}
+
 type PrReviewer struct {
-	PrID   uuid.UUID `json:"pr_id"`
-	UserID uuid.UUID `json:"user_id"`
+	PrID       uuid.UUID          `json:"pr_id"`
+	UserID     uuid.UUID          `json:"user_id"`
+	AssignedAt pgtype.Timestamptz `json:"assigned_at"`
+	TeamID     pgtype.UUID        `json:"team_id"`
+	Verdict    pgtype.Text        `json:"verdict"`
+	VerdictAt  pgtype.Timestamptz `json:"verdict_at"`
 }
 
 type PullRequest struct {
-	ID        uuid.UUID          `json:"id"`
-	Title     string             `json:"title"`
-	AuthorID  uuid.UUID          `json:"author_id"`
-	Status    string             `json:"status"`
-	CreatedAt pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+	ID              uuid.UUID          `json:"id"`
+	Title           string             `json:"title"`
+	AuthorID        uuid.UUID          `json:"author_id"`
+	Status          string             `json:"status"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+	RequiredSkills  []string           `json:"required_skills"`
+	TargetReviewers int32              `json:"target_reviewers"`
+	TeamID          pgtype.UUID        `json:"team_id"`
+	MergeForced     bool               `json:"merge_forced"`
+	MergedAt        pgtype.Timestamptz `json:"merged_at"`
+	MergeForcedBy   pgtype.UUID        `json:"merge_forced_by"`
+	MergeViolations []string           `json:"merge_violations"`
+}
+
+type ReviewerLoad struct {
+	UserID         uuid.UUID          `json:"user_id"`
+	OpenReviews    int64              `json:"open_reviews"`
+	LastAssignedAt pgtype.Timestamptz `json:"last_assigned_at"`
 }
 
 type Team struct {
-	ID   uuid.UUID `json:"id"`
-	Name string    `json:"name"`
+	ID                      uuid.UUID   `json:"id"`
+	Name                    string      `json:"name"`
+	AssignmentStrategy      pgtype.Text `json:"assignment_strategy"`
+	ReviewersCount          int32       `json:"reviewers_count"`
+	MaxOpenReviews          pgtype.Int4 `json:"max_open_reviews"`
+	RequireSenior           bool        `json:"require_senior"`
+	JuniorsNotAlone         bool        `json:"juniors_not_alone"`
+	ParentID                pgtype.UUID `json:"parent_id"`
+	MinApprovals            int32       `json:"min_approvals"`
+	BlockOnChangesRequested bool        `json:"block_on_changes_requested"`
+}
+
+type TeamFallback struct {
+	TeamID         uuid.UUID `json:"team_id"`
+	FallbackTeamID uuid.UUID `json:"fallback_team_id"`
+	Priority       int32     `json:"priority"`
+}
+
+type TeamMember struct {
+	TeamID uuid.UUID   `json:"team_id"`
+	UserID uuid.UUID   `json:"user_id"`
+	Role   pgtype.Text `json:"role"`
 }
 
 type User struct {
-	ID       uuid.UUID   `json:"id"`
-	Name     string      `json:"name"`
-	IsActive bool        `json:"is_active"`
-	TeamID   pgtype.UUID `json:"team_id"`
+	ID             uuid.UUID   `json:"id"`
+	Name           string      `json:"name"`
+	IsActive       bool        `json:"is_active"`
+	TeamID         pgtype.UUID `json:"team_id"`
+	Skills         []string    `json:"skills"`
+	MaxOpenReviews pgtype.Int4 `json:"max_open_reviews"`
+	Seniority      string      `json:"seniority"`
+}
+
+type UserAbsence struct {
+	ID             uuid.UUID          `json:"id"`
+	UserID         uuid.UUID          `json:"user_id"`
+	StartsAt       pgtype.Timestamptz `json:"starts_at"`
+	EndsAt         pgtype.Timestamptz `json:"ends_at"`
+	Reason         string             `json:"reason"`
+	ProcessedAt    pgtype.Timestamptz `json:"processed_at"`
+	EndProcessedAt pgtype.Timestamptz `json:"end_processed_at"`
 }
@@ -12,29 +12,268 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addOwnershipRule = `-- name: AddOwnershipRule :exec
+INSERT INTO ownership_rules (team_id, repository, position, pattern, owner_ids)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type AddOwnershipRuleParams struct {
+	TeamID     pgtype.UUID `json:"team_id"`
+	Repository pgtype.Text `json:"repository"`
+	Position   int32       `json:"position"`
+	Pattern    string      `json:"pattern"`
+	OwnerIds   []uuid.UUID `json:"owner_ids"`
+}
+
+func (q *Queries) AddOwnershipRule(ctx context.Context, arg AddOwnershipRuleParams) error {
+	_, err := q.db.Exec(ctx, addOwnershipRule,
+		arg.TeamID,
+		arg.Repository,
+		arg.Position,
+		arg.Pattern,
+		arg.OwnerIds,
+	)
+	return err
+}
+
+const addReviewersToPRs = `-- name: AddReviewersToPRs :exec
+INSERT INTO pr_reviewers (pr_id, user_id, team_id)
+SELECT unnest($1::uuid[]), unnest($2::uuid[]), unnest($3::uuid[])
+ON CONFLICT (pr_id, user_id) DO NOTHING
+`
+
+type AddReviewersToPRsParams struct {
+	PrIds   []uuid.UUID `json:"pr_ids"`
+	UserIds []uuid.UUID `json:"user_ids"`
+	TeamIds []uuid.UUID `json:"team_ids"`
+}
+
+// массовое добавление назначений (pr_ids[i], user_ids[i], team_ids[i])
+func (q *Queries) AddReviewersToPRs(ctx context.Context, arg AddReviewersToPRsParams) error {
+	_, err := q.db.Exec(ctx, addReviewersToPRs, arg.PrIds, arg.UserIds, arg.TeamIds)
+	return err
+}
+
 const addReviewerToPR = `-- name: AddReviewerToPR :exec
 
-INSERT INTO pr_reviewers (pr_id, user_id)
-VALUES ($1, $2)
+INSERT INTO pr_reviewers (pr_id, user_id, team_id)
+VALUES ($1, $2, $3)
 ON CONFLICT (pr_id, user_id) DO NOTHING
 `
 
 type AddReviewerToPRParams struct {
-	PrID   uuid.UUID `json:"pr_id"`
-	UserID uuid.UUID `json:"user_id"`
+	PrID   uuid.UUID   `json:"pr_id"`
+	UserID uuid.UUID   `json:"user_id"`
+	TeamID pgtype.UUID `json:"team_id"`
 }
 
 // --- Ревьюверы ---
+// team_id - команда, из которой взят ревьювер; NULL, если он назначен не через команду
 func (q *Queries) AddReviewerToPR(ctx context.Context, arg AddReviewerToPRParams) error {
-	_, err := q.db.Exec(ctx, addReviewerToPR, arg.PrID, arg.UserID)
+	_, err := q.db.Exec(ctx, addReviewerToPR, arg.PrID, arg.UserID, arg.TeamID)
+	return err
+}
+
+const addTeamFallback = `-- name: AddTeamFallback :exec
+INSERT INTO team_fallbacks (team_id, fallback_team_id, priority)
+VALUES ($1, $2, $3)
+`
+
+type AddTeamFallbackParams struct {
+	TeamID         uuid.UUID `json:"team_id"`
+	FallbackTeamID uuid.UUID `json:"fallback_team_id"`
+	Priority       int32     `json:"priority"`
+}
+
+func (q *Queries) AddTeamFallback(ctx context.Context, arg AddTeamFallbackParams) error {
+	_, err := q.db.Exec(ctx, addTeamFallback, arg.TeamID, arg.FallbackTeamID, arg.Priority)
+	return err
+}
+
+const addTeamMember = `-- name: AddTeamMember :exec
+INSERT INTO team_members (team_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (team_id, user_id) DO UPDATE
+    SET role = EXCLUDED.role
+`
+
+type AddTeamMemberParams struct {
+	TeamID uuid.UUID   `json:"team_id"`
+	UserID uuid.UUID   `json:"user_id"`
+	Role   pgtype.Text `json:"role"`
+}
+
+// добавляет участника в команду или меняет его роль в ней
+func (q *Queries) AddTeamMember(ctx context.Context, arg AddTeamMemberParams) error {
+	_, err := q.db.Exec(ctx, addTeamMember, arg.TeamID, arg.UserID, arg.Role)
+	return err
+}
+
+const claimEndedAbsences = `-- name: ClaimEndedAbsences :many
+UPDATE user_absences
+SET end_processed_at = NOW()
+WHERE end_processed_at IS NULL
+  AND ends_at <= NOW()
+RETURNING id, user_id, starts_at, ends_at, reason, processed_at, end_processed_at
+`
+
+// помечает закончившиеся и ещё не обработанные отсутствия и возвращает их
+func (q *Queries) ClaimEndedAbsences(ctx context.Context) ([]UserAbsence, error) {
+	rows, err := q.db.Query(ctx, claimEndedAbsences)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserAbsence
+	for rows.Next() {
+		var i UserAbsence
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.StartsAt,
+			&i.EndsAt,
+			&i.Reason,
+			&i.ProcessedAt,
+			&i.EndProcessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimStartedAbsences = `-- name: ClaimStartedAbsences :many
+UPDATE user_absences
+SET processed_at = NOW()
+WHERE processed_at IS NULL
+  AND starts_at <= NOW()
+  AND ends_at > NOW()
+RETURNING id, user_id, starts_at, ends_at, reason, processed_at, end_processed_at
+`
+
+// помечает начавшиеся и ещё не обработанные отсутствия и возвращает их
+func (q *Queries) ClaimStartedAbsences(ctx context.Context) ([]UserAbsence, error) {
+	rows, err := q.db.Query(ctx, claimStartedAbsences)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserAbsence
+	for rows.Next() {
+		var i UserAbsence
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.StartsAt,
+			&i.EndsAt,
+			&i.Reason,
+			&i.ProcessedAt,
+			&i.EndProcessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const closeAssignments = `-- name: CloseAssignments :exec
+UPDATE pr_assignments a
+SET removed_at = NOW()
+FROM unnest($1::uuid[], $2::uuid[]) AS r(pr_id, user_id)
+WHERE a.pr_id = r.pr_id
+  AND a.user_id = r.user_id
+  AND a.removed_at IS NULL
+`
+
+type CloseAssignmentsParams struct {
+	PrIds   []uuid.UUID `json:"pr_ids"`
+	UserIds []uuid.UUID `json:"user_ids"`
+}
+
+// отмечает снятие ревьюверов (pr_ids[i], user_ids[i]) в истории назначений
+func (q *Queries) CloseAssignments(ctx context.Context, arg CloseAssignmentsParams) error {
+	_, err := q.db.Exec(ctx, closeAssignments, arg.PrIds, arg.UserIds)
 	return err
 }
 
+const countCandidatesAtCapacity = `-- name: CountCandidatesAtCapacity :one
+SELECT COUNT(DISTINCT u1.id)
+FROM team_members tm
+JOIN users u1 ON u1.id = tm.user_id
+JOIN teams t ON t.id = tm.team_id
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+WHERE tm.team_id = ANY($1::uuid[])
+  AND u1.id <> ALL($2::uuid[])
+  AND u1.is_active = true
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+  )
+  AND COALESCE(ol.open_reviews, 0) >= COALESCE(u1.max_open_reviews, t.max_open_reviews)
+`
+
+type CountCandidatesAtCapacityParams struct {
+	TeamIds    []uuid.UUID `json:"team_ids"`
+	ExcludeIds []uuid.UUID `json:"exclude_ids"`
+}
+
+// активные участники команд, пропущенные при подборе только из-за лимита открытых ревью;
+// лимит берётся у той команды, из которой их подбирали
+func (q *Queries) CountCandidatesAtCapacity(ctx context.Context, arg CountCandidatesAtCapacityParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countCandidatesAtCapacity, arg.TeamIds, arg.ExcludeIds)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAbsence = `-- name: CreateAbsence :one
+
+INSERT INTO user_absences (user_id, starts_at, ends_at, reason)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, starts_at, ends_at, reason, processed_at, end_processed_at
+`
+
+type CreateAbsenceParams struct {
+	UserID   uuid.UUID          `json:"user_id"`
+	StartsAt pgtype.Timestamptz `json:"starts_at"`
+	EndsAt   pgtype.Timestamptz `json:"ends_at"`
+	Reason   string             `json:"reason"`
+}
+
+// --- Отсутствия ---
+func (q *Queries) CreateAbsence(ctx context.Context, arg CreateAbsenceParams) (UserAbsence, error) {
+	row := q.db.QueryRow(ctx, createAbsence,
+		arg.UserID,
+		arg.StartsAt,
+		arg.EndsAt,
+		arg.Reason,
+	)
+	var i UserAbsence
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.StartsAt,
+		&i.EndsAt,
+		&i.Reason,
+		&i.ProcessedAt,
+		&i.EndProcessedAt,
+	)
+	return i, err
+}
+
 const createPullRequest = `-- name: CreatePullRequest :one
 
 INSERT INTO pull_requests (title, author_id)
 VALUES ($1, $2)
-RETURNING id, title, author_id, status, created_at, updated_at
+RETURNING id, title, author_id, status, created_at, updated_at, required_skills, target_reviewers, team_id, merge_forced, merged_at, merge_forced_by, merge_violations
 `
 
 type CreatePullRequestParams struct {
@@ -53,24 +292,43 @@ func (q *Queries) CreatePullRequest(ctx context.Context, arg CreatePullRequestPa
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RequiredSkills,
+		&i.TargetReviewers,
+		&i.TeamID,
+		&i.MergeForced,
+		&i.MergedAt,
+		&i.MergeForcedBy,
+		&i.MergeViolations,
 	)
 	return i, err
 }
 
 const createPullRequestWithID = `-- name: CreatePullRequestWithID :one
-INSERT INTO pull_requests (id, title, author_id)
-VALUES ($1, $2, $3)
-RETURNING id, title, author_id, status, created_at, updated_at
+INSERT INTO pull_requests (id, title, author_id, required_skills, target_reviewers, team_id, status)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, title, author_id, status, created_at, updated_at, required_skills, target_reviewers, team_id, merge_forced, merged_at, merge_forced_by, merge_violations
 `
 
 type CreatePullRequestWithIDParams struct {
-	ID       uuid.UUID `json:"id"`
-	Title    string    `json:"title"`
-	AuthorID uuid.UUID `json:"author_id"`
+	ID              uuid.UUID   `json:"id"`
+	Title           string      `json:"title"`
+	AuthorID        uuid.UUID   `json:"author_id"`
+	RequiredSkills  []string    `json:"required_skills"`
+	TargetReviewers int32       `json:"target_reviewers"`
+	TeamID          pgtype.UUID `json:"team_id"`
+	Status          string      `json:"status"`
 }
 
 func (q *Queries) CreatePullRequestWithID(ctx context.Context, arg CreatePullRequestWithIDParams) (PullRequest, error) {
-	row := q.db.QueryRow(ctx, createPullRequestWithID, arg.ID, arg.Title, arg.AuthorID)
+	row := q.db.QueryRow(ctx, createPullRequestWithID,
+		arg.ID,
+		arg.Title,
+		arg.AuthorID,
+		arg.RequiredSkills,
+		arg.TargetReviewers,
+		arg.TeamID,
+		arg.Status,
+	)
 	var i PullRequest
 	err := row.Scan(
 		&i.ID,
@@ -79,6 +337,13 @@ func (q *Queries) CreatePullRequestWithID(ctx context.Context, arg CreatePullReq
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RequiredSkills,
+		&i.TargetReviewers,
+		&i.TeamID,
+		&i.MergeForced,
+		&i.MergedAt,
+		&i.MergeForcedBy,
+		&i.MergeViolations,
 	)
 	return i, err
 }
@@ -87,14 +352,25 @@ const createTeam = `-- name: CreateTeam :one
 
 INSERT INTO teams (name)
 VALUES ($1)
-RETURNING id, name
+RETURNING id, name, assignment_strategy, reviewers_count, max_open_reviews, require_senior, juniors_not_alone, parent_id, min_approvals, block_on_changes_requested
 `
 
 // --- Команды ---
 func (q *Queries) CreateTeam(ctx context.Context, name string) (Team, error) {
 	row := q.db.QueryRow(ctx, createTeam, name)
 	var i Team
-	err := row.Scan(&i.ID, &i.Name)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AssignmentStrategy,
+		&i.ReviewersCount,
+		&i.MaxOpenReviews,
+		&i.RequireSenior,
+		&i.JuniorsNotAlone,
+		&i.ParentID,
+		&i.MinApprovals,
+		&i.BlockOnChangesRequested,
+	)
 	return i, err
 }
 
@@ -102,7 +378,7 @@ const createUser = `-- name: CreateUser :one
 
 INSERT INTO users (name, team_id)
 VALUES ($1, $2)
-RETURNING id, name, is_active, team_id
+RETURNING id, name, is_active, team_id, skills, max_open_reviews, seniority
 `
 
 type CreateUserParams struct {
@@ -119,42 +395,56 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Name,
 		&i.IsActive,
 		&i.TeamID,
+		&i.Skills,
+		&i.MaxOpenReviews,
+		&i.Seniority,
 	)
 	return i, err
 }
 
-const deactivateUsersByTeam = `-- name: DeactivateUsersByTeam :exec
-UPDATE users
-SET is_active = false
-WHERE team_id = $1 AND is_active = true
+const deactivateUsersByTeam = `-- name: DeactivateUsersByTeam :many
+WITH members AS (
+    SELECT user_id FROM team_members
+    WHERE team_id = $1
+      AND (cardinality($2::uuid[]) = 0 OR user_id = ANY($2::uuid[]))
+), deactivated AS (
+    UPDATE users
+    SET is_active = false
+    WHERE id IN (SELECT user_id FROM members)
+      AND NOT EXISTS (
+            SELECT 1 FROM team_members o
+            WHERE o.user_id = users.id AND o.team_id <> $1
+      )
+    RETURNING id
+)
+SELECT m.user_id, (d.id IS NOT NULL)::bool AS deactivated
+FROM members m
+LEFT JOIN deactivated d ON d.id = m.user_id
+ORDER BY m.user_id
 `
 
-func (q *Queries) DeactivateUsersByTeam(ctx context.Context, teamID pgtype.UUID) error {
-	_, err := q.db.Exec(ctx, deactivateUsersByTeam, teamID)
-	return err
+type DeactivateUsersByTeamParams struct {
+	TeamID  uuid.UUID   `json:"team_id"`
+	UserIds []uuid.UUID `json:"user_ids"`
 }
 
-const getAssignmentCountsByPR = `-- name: GetAssignmentCountsByPR :many
-SELECT pr_id, COUNT(*) AS cnt
-FROM pr_reviewers
-GROUP BY pr_id
-`
-
-type GetAssignmentCountsByPRRow struct {
-	PrID uuid.UUID `json:"pr_id"`
-	Cnt  int64     `json:"cnt"`
+type DeactivateUsersByTeamRow struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Deactivated bool      `json:"deactivated"`
 }
 
-func (q *Queries) GetAssignmentCountsByPR(ctx context.Context) ([]GetAssignmentCountsByPRRow, error) {
-	rows, err := q.db.Query(ctx, getAssignmentCountsByPR)
+// деактивирует всю команду или только перечисленных участников (пустой список - вся команда);
+// состоящие и в других командах остаются активными (deactivated = false)
+func (q *Queries) DeactivateUsersByTeam(ctx context.Context, arg DeactivateUsersByTeamParams) ([]DeactivateUsersByTeamRow, error) {
+	rows, err := q.db.Query(ctx, deactivateUsersByTeam, arg.TeamID, arg.UserIds)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetAssignmentCountsByPRRow
+	var items []DeactivateUsersByTeamRow
 	for rows.Next() {
-		var i GetAssignmentCountsByPRRow
-		if err := rows.Scan(&i.PrID, &i.Cnt); err != nil {
+		var i DeactivateUsersByTeamRow
+		if err := rows.Scan(&i.UserID, &i.Deactivated); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -165,29 +455,69 @@ func (q *Queries) GetAssignmentCountsByPR(ctx context.Context) ([]GetAssignmentC
 	return items, nil
 }
 
-const getAssignmentCountsByUser = `-- name: GetAssignmentCountsByUser :many
+const deleteAbsence = `-- name: DeleteAbsence :execrows
+DELETE FROM user_absences
+WHERE id = $1
+`
 
-SELECT user_id, COUNT(*) AS cnt
-FROM pr_reviewers
-GROUP BY user_id
+func (q *Queries) DeleteAbsence(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteAbsence, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteOwnershipRules = `-- name: DeleteOwnershipRules :exec
+DELETE FROM ownership_rules
+WHERE team_id IS NOT DISTINCT FROM $1
+  AND repository IS NOT DISTINCT FROM $2
 `
 
-type GetAssignmentCountsByUserRow struct {
-	UserID uuid.UUID `json:"user_id"`
-	Cnt    int64     `json:"cnt"`
+type DeleteOwnershipRulesParams struct {
+	TeamID     pgtype.UUID `json:"team_id"`
+	Repository pgtype.Text `json:"repository"`
 }
 
-// --- Статистика назначений ---
-func (q *Queries) GetAssignmentCountsByUser(ctx context.Context) ([]GetAssignmentCountsByUserRow, error) {
-	rows, err := q.db.Query(ctx, getAssignmentCountsByUser)
+func (q *Queries) DeleteOwnershipRules(ctx context.Context, arg DeleteOwnershipRulesParams) error {
+	_, err := q.db.Exec(ctx, deleteOwnershipRules, arg.TeamID, arg.Repository)
+	return err
+}
+
+const deleteTeamFallbacks = `-- name: DeleteTeamFallbacks :exec
+DELETE FROM team_fallbacks
+WHERE team_id = $1
+`
+
+func (q *Queries) DeleteTeamFallbacks(ctx context.Context, teamID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteTeamFallbacks, teamID)
+	return err
+}
+
+const getAbsencesForUser = `-- name: GetAbsencesForUser :many
+SELECT id, user_id, starts_at, ends_at, reason, processed_at, end_processed_at FROM user_absences
+WHERE user_id = $1
+ORDER BY starts_at
+`
+
+func (q *Queries) GetAbsencesForUser(ctx context.Context, userID uuid.UUID) ([]UserAbsence, error) {
+	rows, err := q.db.Query(ctx, getAbsencesForUser, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetAssignmentCountsByUserRow
+	var items []UserAbsence
 	for rows.Next() {
-		var i GetAssignmentCountsByUserRow
-		if err := rows.Scan(&i.UserID, &i.Cnt); err != nil {
+		var i UserAbsence
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.StartsAt,
+			&i.EndsAt,
+			&i.Reason,
+			&i.ProcessedAt,
+			&i.EndProcessedAt,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -198,31 +528,63 @@ func (q *Queries) GetAssignmentCountsByUser(ctx context.Context) ([]GetAssignmen
 	return items, nil
 }
 
-const getCandidatesForInitialReview = `-- name: GetCandidatesForInitialReview :many
-
-SELECT id, name, is_active, team_id FROM users u1
-WHERE team_id = (SELECT team_id FROM users u2 WHERE u2.id = $1)
+const getActiveCandidatesByIDs = `-- name: GetActiveCandidatesByIDs :many
+SELECT u1.id, u1.name, u1.is_active, u1.team_id, u1.skills, u1.seniority,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       ol.last_assigned_at::timestamptz AS last_assigned_at,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM users u1
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = COALESCE($1, u1.team_id)
+WHERE u1.id = ANY($2::uuid[])
   AND u1.is_active = true
-  AND u1.id != $1
-ORDER BY random()
-LIMIT 2
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+  )
+  AND (COALESCE(u1.max_open_reviews, t.max_open_reviews) IS NULL
+       OR COALESCE(ol.open_reviews, 0) < COALESCE(u1.max_open_reviews, t.max_open_reviews))
+ORDER BY u1.id
 `
 
-// --- Кандидаты на ревью ---
-func (q *Queries) GetCandidatesForInitialReview(ctx context.Context, id uuid.UUID) ([]User, error) {
-	rows, err := q.db.Query(ctx, getCandidatesForInitialReview, id)
+type GetActiveCandidatesByIDsParams struct {
+	TeamID pgtype.UUID `json:"team_id"`
+	Ids    []uuid.UUID `json:"ids"`
+}
+
+type GetActiveCandidatesByIDsRow struct {
+	ID             uuid.UUID          `json:"id"`
+	Name           string             `json:"name"`
+	IsActive       bool               `json:"is_active"`
+	TeamID         pgtype.UUID        `json:"team_id"`
+	Skills         []string           `json:"skills"`
+	Seniority      string             `json:"seniority"`
+	OpenReviews    int64              `json:"open_reviews"`
+	LastAssignedAt pgtype.Timestamptz `json:"last_assigned_at"`
+	MaxOpenReviews pgtype.Int4        `json:"max_open_reviews"`
+}
+
+// активные пользователи из списка с данными о загрузке (владельцы кода);
+// лимит открытых ревью - команды PR, а без неё основной команды пользователя
+func (q *Queries) GetActiveCandidatesByIDs(ctx context.Context, arg GetActiveCandidatesByIDsParams) ([]GetActiveCandidatesByIDsRow, error) {
+	rows, err := q.db.Query(ctx, getActiveCandidatesByIDs, arg.TeamID, arg.Ids)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []User
+	var items []GetActiveCandidatesByIDsRow
 	for rows.Next() {
-		var i User
+		var i GetActiveCandidatesByIDsRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.Name,
 			&i.IsActive,
 			&i.TeamID,
+			&i.Skills,
+			&i.Seniority,
+			&i.OpenReviews,
+			&i.LastAssignedAt,
+			&i.MaxOpenReviews,
 		); err != nil {
 			return nil, err
 		}
@@ -234,36 +596,60 @@ func (q *Queries) GetCandidatesForInitialReview(ctx context.Context, id uuid.UUI
 	return items, nil
 }
 
-const getCandidatesForReassignment = `-- name: GetCandidatesForReassignment :many
-SELECT id, name, is_active, team_id FROM users u1
-WHERE team_id = (SELECT team_id FROM users u2 WHERE u2.id = $1)
+const getActiveTeamCandidates = `-- name: GetActiveTeamCandidates :many
+SELECT u1.id, u1.name, u1.is_active, u1.team_id, u1.skills, u1.seniority,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       ol.last_assigned_at::timestamptz AS last_assigned_at,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM users u1
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = $1
+WHERE EXISTS (
+        SELECT 1 FROM team_members tm
+        WHERE tm.user_id = u1.id AND tm.team_id = $1
+  )
   AND u1.is_active = true
-  AND u1.id != $1
-  AND u1.id NOT IN (
-        SELECT user_id FROM pr_reviewers WHERE pr_id = $2
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
   )
-LIMIT 5
+  AND (COALESCE(u1.max_open_reviews, t.max_open_reviews) IS NULL
+       OR COALESCE(ol.open_reviews, 0) < COALESCE(u1.max_open_reviews, t.max_open_reviews))
+ORDER BY u1.id
 `
 
-type GetCandidatesForReassignmentParams struct {
-	ID   uuid.UUID `json:"id"`
-	PrID uuid.UUID `json:"pr_id"`
+type GetActiveTeamCandidatesRow struct {
+	ID             uuid.UUID          `json:"id"`
+	Name           string             `json:"name"`
+	IsActive       bool               `json:"is_active"`
+	TeamID         pgtype.UUID        `json:"team_id"`
+	Skills         []string           `json:"skills"`
+	Seniority      string             `json:"seniority"`
+	OpenReviews    int64              `json:"open_reviews"`
+	LastAssignedAt pgtype.Timestamptz `json:"last_assigned_at"`
+	MaxOpenReviews pgtype.Int4        `json:"max_open_reviews"`
 }
 
-func (q *Queries) GetCandidatesForReassignment(ctx context.Context, arg GetCandidatesForReassignmentParams) ([]User, error) {
-	rows, err := q.db.Query(ctx, getCandidatesForReassignment, arg.ID, arg.PrID)
+// активные участники команды с данными о загрузке (для массового переназначения)
+func (q *Queries) GetActiveTeamCandidates(ctx context.Context, teamID uuid.UUID) ([]GetActiveTeamCandidatesRow, error) {
+	rows, err := q.db.Query(ctx, getActiveTeamCandidates, teamID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []User
+	var items []GetActiveTeamCandidatesRow
 	for rows.Next() {
-		var i User
+		var i GetActiveTeamCandidatesRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.Name,
 			&i.IsActive,
 			&i.TeamID,
+			&i.Skills,
+			&i.Seniority,
+			&i.OpenReviews,
+			&i.LastAssignedAt,
+			&i.MaxOpenReviews,
 		); err != nil {
 			return nil, err
 		}
@@ -275,30 +661,29 @@ func (q *Queries) GetCandidatesForReassignment(ctx context.Context, arg GetCandi
 	return items, nil
 }
 
-const getOpenPullRequestsForReviewer = `-- name: GetOpenPullRequestsForReviewer :many
-SELECT pr.id, pr.title, pr.author_id, pr.status, pr.created_at, pr.updated_at
-FROM pull_requests pr
-JOIN pr_reviewers prr ON pr.id = prr.pr_id
-WHERE prr.user_id = $1 AND pr.status = 'OPEN'
+const getAssignmentCountsByPR = `-- name: GetAssignmentCountsByPR :many
+SELECT prr.pr_id, pr.status, COUNT(*) AS cnt
+FROM pr_reviewers prr
+JOIN pull_requests pr ON pr.id = prr.pr_id
+GROUP BY prr.pr_id, pr.status
 `
 
-func (q *Queries) GetOpenPullRequestsForReviewer(ctx context.Context, userID uuid.UUID) ([]PullRequest, error) {
-	rows, err := q.db.Query(ctx, getOpenPullRequestsForReviewer, userID)
+type GetAssignmentCountsByPRRow struct {
+	PrID   uuid.UUID `json:"pr_id"`
+	Status string    `json:"status"`
+	Cnt    int64     `json:"cnt"`
+}
+
+func (q *Queries) GetAssignmentCountsByPR(ctx context.Context) ([]GetAssignmentCountsByPRRow, error) {
+	rows, err := q.db.Query(ctx, getAssignmentCountsByPR)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []PullRequest
+	var items []GetAssignmentCountsByPRRow
 	for rows.Next() {
-		var i PullRequest
-		if err := rows.Scan(
-			&i.ID,
-			&i.Title,
-			&i.AuthorID,
-			&i.Status,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-		); err != nil {
+		var i GetAssignmentCountsByPRRow
+		if err := rows.Scan(&i.PrID, &i.Status, &i.Cnt); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -309,58 +694,42 @@ func (q *Queries) GetOpenPullRequestsForReviewer(ctx context.Context, userID uui
 	return items, nil
 }
 
-const getPullRequest = `-- name: GetPullRequest :one
-SELECT id, title, author_id, status, created_at, updated_at FROM pull_requests
-WHERE id = $1
-`
-
-func (q *Queries) GetPullRequest(ctx context.Context, id uuid.UUID) (PullRequest, error) {
-	row := q.db.QueryRow(ctx, getPullRequest, id)
-	var i PullRequest
-	err := row.Scan(
-		&i.ID,
-		&i.Title,
-		&i.AuthorID,
-		&i.Status,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-	)
-	return i, err
-}
+const getAssignmentCountsByUser = `-- name: GetAssignmentCountsByUser :many
 
-const getReviewerCountForPR = `-- name: GetReviewerCountForPR :one
-SELECT count(*) FROM pr_reviewers
-WHERE pr_id = $1
+SELECT prr.user_id, COUNT(*) AS cnt,
+       COUNT(*) FILTER (WHERE pr.status = 'OPEN') AS open_cnt,
+       COUNT(*) FILTER (WHERE pr.status = 'MERGED') AS merged_cnt,
+       COUNT(*) FILTER (WHERE pr.status = 'CLOSED') AS closed_cnt
+FROM pr_reviewers prr
+JOIN pull_requests pr ON pr.id = prr.pr_id
+GROUP BY prr.user_id
 `
 
-func (q *Queries) GetReviewerCountForPR(ctx context.Context, prID uuid.UUID) (int64, error) {
-	row := q.db.QueryRow(ctx, getReviewerCountForPR, prID)
-	var count int64
-	err := row.Scan(&count)
-	return count, err
+type GetAssignmentCountsByUserRow struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Cnt       int64     `json:"cnt"`
+	OpenCnt   int64     `json:"open_cnt"`
+	MergedCnt int64     `json:"merged_cnt"`
+	ClosedCnt int64     `json:"closed_cnt"`
 }
 
-const getReviewersForPR = `-- name: GetReviewersForPR :many
-SELECT users.id, users.name, users.is_active, users.team_id
-FROM users
-JOIN pr_reviewers ON users.id = pr_reviewers.user_id
-WHERE pr_reviewers.pr_id = $1
-`
-
-func (q *Queries) GetReviewersForPR(ctx context.Context, prID uuid.UUID) ([]User, error) {
-	rows, err := q.db.Query(ctx, getReviewersForPR, prID)
+// --- Статистика назначений ---
+// всего назначений и в разбивке по состоянию PR; у черновиков ревьюверов нет
+func (q *Queries) GetAssignmentCountsByUser(ctx context.Context) ([]GetAssignmentCountsByUserRow, error) {
+	rows, err := q.db.Query(ctx, getAssignmentCountsByUser)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []User
+	var items []GetAssignmentCountsByUserRow
 	for rows.Next() {
-		var i User
+		var i GetAssignmentCountsByUserRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.IsActive,
-			&i.TeamID,
+			&i.UserID,
+			&i.Cnt,
+			&i.OpenCnt,
+			&i.MergedCnt,
+			&i.ClosedCnt,
 		); err != nil {
 			return nil, err
 		}
@@ -372,32 +741,982 @@ func (q *Queries) GetReviewersForPR(ctx context.Context, prID uuid.UUID) ([]User
 	return items, nil
 }
 
-const getTeam = `-- name: GetTeam :one
-SELECT id, name FROM teams
-WHERE id = $1
+const getAssignmentsForPR = `-- name: GetAssignmentsForPR :many
+SELECT a.user_id, a.reason, a.replaced_user_id, t.name AS team_name, a.strategy, a.inputs,
+       a.assigned_at, a.removed_at
+FROM pr_assignments a
+LEFT JOIN teams t ON t.id = a.team_id
+WHERE a.pr_id = $1
+ORDER BY a.assigned_at, a.user_id
+`
+
+type GetAssignmentsForPRRow struct {
+	UserID         uuid.UUID          `json:"user_id"`
+	Reason         string             `json:"reason"`
+	ReplacedUserID pgtype.UUID        `json:"replaced_user_id"`
+	TeamName       pgtype.Text        `json:"team_name"`
+	Strategy       pgtype.Text        `json:"strategy"`
+	Inputs         []byte             `json:"inputs"`
+	AssignedAt     pgtype.Timestamptz `json:"assigned_at"`
+	RemovedAt      pgtype.Timestamptz `json:"removed_at"`
+}
+
+// история назначений PR вместе с названием команды, из которой взят ревьювер
+func (q *Queries) GetAssignmentsForPR(ctx context.Context, prID uuid.UUID) ([]GetAssignmentsForPRRow, error) {
+	rows, err := q.db.Query(ctx, getAssignmentsForPR, prID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAssignmentsForPRRow
+	for rows.Next() {
+		var i GetAssignmentsForPRRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Reason,
+			&i.ReplacedUserID,
+			&i.TeamName,
+			&i.Strategy,
+			&i.Inputs,
+			&i.AssignedAt,
+			&i.RemovedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCandidatesForInitialReview = `-- name: GetCandidatesForInitialReview :many
+
+SELECT u1.id, u1.name, u1.is_active, u1.team_id, u1.skills, u1.seniority,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       ol.last_assigned_at::timestamptz AS last_assigned_at,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM users u1
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = $1
+WHERE EXISTS (
+        SELECT 1 FROM team_members tm
+        WHERE tm.user_id = u1.id AND tm.team_id = $1
+  )
+  AND u1.is_active = true
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+  )
+  AND (COALESCE(u1.max_open_reviews, t.max_open_reviews) IS NULL
+       OR COALESCE(ol.open_reviews, 0) < COALESCE(u1.max_open_reviews, t.max_open_reviews))
+  AND u1.id != $2
+ORDER BY u1.id
+`
+
+type GetCandidatesForInitialReviewParams struct {
+	TeamID   uuid.UUID `json:"team_id"`
+	AuthorID uuid.UUID `json:"author_id"`
+}
+
+type GetCandidatesForInitialReviewRow struct {
+	ID             uuid.UUID          `json:"id"`
+	Name           string             `json:"name"`
+	IsActive       bool               `json:"is_active"`
+	TeamID         pgtype.UUID        `json:"team_id"`
+	Skills         []string           `json:"skills"`
+	Seniority      string             `json:"seniority"`
+	OpenReviews    int64              `json:"open_reviews"`
+	LastAssignedAt pgtype.Timestamptz `json:"last_assigned_at"`
+	MaxOpenReviews pgtype.Int4        `json:"max_open_reviews"`
+}
+
+// --- Кандидаты на ревью ---
+// все активные участники команды PR, кроме автора, с данными о загрузке; выбор делает стратегия команды
+func (q *Queries) GetCandidatesForInitialReview(ctx context.Context, arg GetCandidatesForInitialReviewParams) ([]GetCandidatesForInitialReviewRow, error) {
+	rows, err := q.db.Query(ctx, getCandidatesForInitialReview, arg.TeamID, arg.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCandidatesForInitialReviewRow
+	for rows.Next() {
+		var i GetCandidatesForInitialReviewRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.IsActive,
+			&i.TeamID,
+			&i.Skills,
+			&i.Seniority,
+			&i.OpenReviews,
+			&i.LastAssignedAt,
+			&i.MaxOpenReviews,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCandidatesForReassignment = `-- name: GetCandidatesForReassignment :many
+SELECT u1.id, u1.name, u1.is_active, u1.team_id, u1.skills, u1.seniority,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       ol.last_assigned_at::timestamptz AS last_assigned_at,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM users u1
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = $1
+WHERE EXISTS (
+        SELECT 1 FROM team_members tm
+        WHERE tm.user_id = u1.id AND tm.team_id = $1
+  )
+  AND u1.is_active = true
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+  )
+  AND (COALESCE(u1.max_open_reviews, t.max_open_reviews) IS NULL
+       OR COALESCE(ol.open_reviews, 0) < COALESCE(u1.max_open_reviews, t.max_open_reviews))
+  AND u1.id != $2
+  AND u1.id != (SELECT author_id FROM pull_requests WHERE id = $3)
+  AND u1.id NOT IN (
+        SELECT user_id FROM pr_reviewers WHERE pr_id = $3
+  )
+ORDER BY u1.id
+`
+
+type GetCandidatesForReassignmentParams struct {
+	TeamID uuid.UUID `json:"team_id"`
+	ID     uuid.UUID `json:"id"`
+	PrID   uuid.UUID `json:"pr_id"`
+}
+
+type GetCandidatesForReassignmentRow struct {
+	ID             uuid.UUID          `json:"id"`
+	Name           string             `json:"name"`
+	IsActive       bool               `json:"is_active"`
+	TeamID         pgtype.UUID        `json:"team_id"`
+	Skills         []string           `json:"skills"`
+	Seniority      string             `json:"seniority"`
+	OpenReviews    int64              `json:"open_reviews"`
+	LastAssignedAt pgtype.Timestamptz `json:"last_assigned_at"`
+	MaxOpenReviews pgtype.Int4        `json:"max_open_reviews"`
+}
+
+// активные участники команды, из которой взят заменяемый ревьювер, кроме автора и текущих ревьюверов
+func (q *Queries) GetCandidatesForReassignment(ctx context.Context, arg GetCandidatesForReassignmentParams) ([]GetCandidatesForReassignmentRow, error) {
+	rows, err := q.db.Query(ctx, getCandidatesForReassignment, arg.TeamID, arg.ID, arg.PrID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCandidatesForReassignmentRow
+	for rows.Next() {
+		var i GetCandidatesForReassignmentRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.IsActive,
+			&i.TeamID,
+			&i.Skills,
+			&i.Seniority,
+			&i.OpenReviews,
+			&i.LastAssignedAt,
+			&i.MaxOpenReviews,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChildTeams = `-- name: GetChildTeams :many
+SELECT id, name, assignment_strategy, reviewers_count, max_open_reviews, require_senior, juniors_not_alone, parent_id, min_approvals, block_on_changes_requested FROM teams
+WHERE parent_id = $1
+ORDER BY name
+`
+
+// подкоманды по имени
+func (q *Queries) GetChildTeams(ctx context.Context, parentID pgtype.UUID) ([]Team, error) {
+	rows, err := q.db.Query(ctx, getChildTeams, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Team
+	for rows.Next() {
+		var i Team
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.AssignmentStrategy,
+			&i.ReviewersCount,
+			&i.MaxOpenReviews,
+			&i.RequireSenior,
+			&i.JuniorsNotAlone,
+			&i.ParentID,
+			&i.MinApprovals,
+			&i.BlockOnChangesRequested,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOpenPullRequestsForReviewer = `-- name: GetOpenPullRequestsForReviewer :many
+SELECT pr.id, pr.title, pr.author_id, pr.status, pr.created_at, pr.updated_at, pr.required_skills, pr.target_reviewers, pr.team_id, pr.merge_forced, pr.merged_at, pr.merge_forced_by, pr.merge_violations
+FROM pull_requests pr
+JOIN pr_reviewers prr ON pr.id = prr.pr_id
+WHERE prr.user_id = $1 AND pr.status = 'OPEN'
+`
+
+func (q *Queries) GetOpenPullRequestsForReviewer(ctx context.Context, userID uuid.UUID) ([]PullRequest, error) {
+	rows, err := q.db.Query(ctx, getOpenPullRequestsForReviewer, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PullRequest
+	for rows.Next() {
+		var i PullRequest
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.AuthorID,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.RequiredSkills,
+			&i.TargetReviewers,
+			&i.TeamID,
+			&i.MergeForced,
+			&i.MergedAt,
+			&i.MergeForcedBy,
+			&i.MergeViolations,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOwnershipRules = `-- name: GetOwnershipRules :many
+
+SELECT team_id, repository, position, pattern, owner_ids FROM ownership_rules
+WHERE team_id IS NOT DISTINCT FROM $1
+  AND repository IS NOT DISTINCT FROM $2
+ORDER BY position
+`
+
+type GetOwnershipRulesParams struct {
+	TeamID     pgtype.UUID `json:"team_id"`
+	Repository pgtype.Text `json:"repository"`
+}
+
+// --- Владельцы кода ---
+// правила команды (repository = NULL) или репозитория (team_id = NULL) по порядку
+func (q *Queries) GetOwnershipRules(ctx context.Context, arg GetOwnershipRulesParams) ([]OwnershipRule, error) {
+	rows, err := q.db.Query(ctx, getOwnershipRules, arg.TeamID, arg.Repository)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OwnershipRule
+	for rows.Next() {
+		var i OwnershipRule
+		if err := rows.Scan(
+			&i.TeamID,
+			&i.Repository,
+			&i.Position,
+			&i.Pattern,
+			&i.OwnerIds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPairCountsByTeam = `-- name: GetPairCountsByTeam :many
+SELECT t.name AS team_name, pr.author_id, pa.user_id AS reviewer_id, COUNT(*) AS pairs
+FROM pr_assignments pa
+JOIN pull_requests pr ON pr.id = pa.pr_id
+JOIN teams t ON t.id = pr.team_id
+WHERE pa.assigned_at >= $1
+GROUP BY t.name, pr.author_id, pa.user_id
+ORDER BY t.name, pr.author_id, pa.user_id
+`
+
+type GetPairCountsByTeamRow struct {
+	TeamName   string    `json:"team_name"`
+	AuthorID   uuid.UUID `json:"author_id"`
+	ReviewerID uuid.UUID `json:"reviewer_id"`
+	Pairs      int64     `json:"pairs"`
+}
+
+// матрица пар автор -> ревьювер с момента since, сгруппированная по команде PR
+func (q *Queries) GetPairCountsByTeam(ctx context.Context, since pgtype.Timestamptz) ([]GetPairCountsByTeamRow, error) {
+	rows, err := q.db.Query(ctx, getPairCountsByTeam, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPairCountsByTeamRow
+	for rows.Next() {
+		var i GetPairCountsByTeamRow
+		if err := rows.Scan(
+			&i.TeamName,
+			&i.AuthorID,
+			&i.ReviewerID,
+			&i.Pairs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPendingPullRequestsForReviewer = `-- name: GetPendingPullRequestsForReviewer :many
+SELECT pr.id, pr.title, pr.author_id, pr.status, pr.created_at, pr.updated_at, pr.required_skills, pr.target_reviewers, pr.team_id, pr.merge_forced, pr.merged_at, pr.merge_forced_by, pr.merge_violations
+FROM pull_requests pr
+JOIN pr_reviewers prr ON pr.id = prr.pr_id
+WHERE prr.user_id = $1 AND pr.status = 'OPEN'
+  AND (prr.verdict IS NULL OR prr.verdict = 'COMMENTED')
+`
+
+// OPEN PR, по которым ревьювер ещё не принял решение (нет вердикта или только комментарии)
+func (q *Queries) GetPendingPullRequestsForReviewer(ctx context.Context, userID uuid.UUID) ([]PullRequest, error) {
+	rows, err := q.db.Query(ctx, getPendingPullRequestsForReviewer, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PullRequest
+	for rows.Next() {
+		var i PullRequest
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.AuthorID,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.RequiredSkills,
+			&i.TargetReviewers,
+			&i.TeamID,
+			&i.MergeForced,
+			&i.MergedAt,
+			&i.MergeForcedBy,
+			&i.MergeViolations,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPREvents = `-- name: GetPREvents :many
+SELECT id, pr_id, event_type, actor_id, user_id, replaced_user_id, from_status, to_status, details, created_at, actor_kind FROM pr_events
+WHERE pr_id = $1
+ORDER BY created_at, id
+`
+
+// лента событий PR в порядке записи
+func (q *Queries) GetPREvents(ctx context.Context, prID uuid.UUID) ([]PrEvent, error) {
+	rows, err := q.db.Query(ctx, getPREvents, prID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PrEvent
+	for rows.Next() {
+		var i PrEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.PrID,
+			&i.EventType,
+			&i.ActorID,
+			&i.UserID,
+			&i.ReplacedUserID,
+			&i.FromStatus,
+			&i.ToStatus,
+			&i.Details,
+			&i.CreatedAt,
+			&i.ActorKind,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPullRequest = `-- name: GetPullRequest :one
+SELECT id, title, author_id, status, created_at, updated_at, required_skills, target_reviewers, team_id, merge_forced, merged_at, merge_forced_by, merge_violations FROM pull_requests
+WHERE id = $1
+`
+
+func (q *Queries) GetPullRequest(ctx context.Context, id uuid.UUID) (PullRequest, error) {
+	row := q.db.QueryRow(ctx, getPullRequest, id)
+	var i PullRequest
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.AuthorID,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RequiredSkills,
+		&i.TargetReviewers,
+		&i.TeamID,
+		&i.MergeForced,
+		&i.MergedAt,
+		&i.MergeForcedBy,
+		&i.MergeViolations,
+	)
+	return i, err
+}
+
+const getPullRequestForUpdate = `-- name: GetPullRequestForUpdate :one
+SELECT id, title, author_id, status, created_at, updated_at, required_skills, target_reviewers, team_id, merge_forced, merged_at, merge_forced_by, merge_violations FROM pull_requests
+WHERE id = $1
+FOR UPDATE
+`
+
+// PR с блокировкой строки до конца транзакции: проверки и изменение статуса видят одно состояние
+func (q *Queries) GetPullRequestForUpdate(ctx context.Context, id uuid.UUID) (PullRequest, error) {
+	row := q.db.QueryRow(ctx, getPullRequestForUpdate, id)
+	var i PullRequest
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.AuthorID,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RequiredSkills,
+		&i.TargetReviewers,
+		&i.TeamID,
+		&i.MergeForced,
+		&i.MergedAt,
+		&i.MergeForcedBy,
+		&i.MergeViolations,
+	)
+	return i, err
+}
+
+const getPullRequestsWithReviewers = `-- name: GetPullRequestsWithReviewers :many
+SELECT pr.id, pr.author_id, pr.required_skills,
+       COALESCE(array_agg(prr.user_id ORDER BY prr.user_id) FILTER (WHERE prr.user_id IS NOT NULL), '{}')::uuid[] AS reviewer_ids,
+       COALESCE(array_agg(u.seniority ORDER BY prr.user_id) FILTER (WHERE prr.user_id IS NOT NULL), '{}')::text[] AS reviewer_seniorities,
+       COALESCE(t.require_senior, false)::bool AS require_senior,
+       COALESCE(t.juniors_not_alone, false)::bool AS juniors_not_alone
+FROM pull_requests pr
+LEFT JOIN pr_reviewers prr ON prr.pr_id = pr.id
+LEFT JOIN users u ON u.id = prr.user_id
+LEFT JOIN teams t ON t.id = pr.team_id
+WHERE pr.id = ANY($1::uuid[])
+GROUP BY pr.id, t.id
+`
+
+type GetPullRequestsWithReviewersRow struct {
+	ID                  uuid.UUID   `json:"id"`
+	AuthorID            uuid.UUID   `json:"author_id"`
+	RequiredSkills      []string    `json:"required_skills"`
+	ReviewerIds         []uuid.UUID `json:"reviewer_ids"`
+	ReviewerSeniorities []string    `json:"reviewer_seniorities"`
+	RequireSenior       bool        `json:"require_senior"`
+	JuniorsNotAlone     bool        `json:"juniors_not_alone"`
+}
+
+// автор, текущие ревьюверы с их уровнями и правила состава команды PR для набора PR
+func (q *Queries) GetPullRequestsWithReviewers(ctx context.Context, prIds []uuid.UUID) ([]GetPullRequestsWithReviewersRow, error) {
+	rows, err := q.db.Query(ctx, getPullRequestsWithReviewers, prIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPullRequestsWithReviewersRow
+	for rows.Next() {
+		var i GetPullRequestsWithReviewersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.AuthorID,
+			&i.RequiredSkills,
+			&i.ReviewerIds,
+			&i.ReviewerSeniorities,
+			&i.RequireSenior,
+			&i.JuniorsNotAlone,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentPairCounts = `-- name: GetRecentPairCounts :many
+
+SELECT pr.author_id, pa.user_id AS reviewer_id, COUNT(*) AS pairs
+FROM pr_assignments pa
+JOIN pull_requests pr ON pr.id = pa.pr_id
+WHERE pr.author_id = ANY($1::uuid[])
+  AND pa.assigned_at >= $2
+GROUP BY pr.author_id, pa.user_id
+`
+
+type GetRecentPairCountsParams struct {
+	AuthorIds []uuid.UUID        `json:"author_ids"`
+	Since     pgtype.Timestamptz `json:"since"`
+}
+
+type GetRecentPairCountsRow struct {
+	AuthorID   uuid.UUID `json:"author_id"`
+	ReviewerID uuid.UUID `json:"reviewer_id"`
+	Pairs      int64     `json:"pairs"`
+}
+
+// --- История пар автор -> ревьювер ---
+// сколько раз с момента since каждый ревьювер назначался на PR каждого из авторов;
+// по истории назначений, поэтому учитываются и снятые, и заменённые ревьюверы
+func (q *Queries) GetRecentPairCounts(ctx context.Context, arg GetRecentPairCountsParams) ([]GetRecentPairCountsRow, error) {
+	rows, err := q.db.Query(ctx, getRecentPairCounts, arg.AuthorIds, arg.Since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecentPairCountsRow
+	for rows.Next() {
+		var i GetRecentPairCountsRow
+		if err := rows.Scan(&i.AuthorID, &i.ReviewerID, &i.Pairs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReviewerCountForPR = `-- name: GetReviewerCountForPR :one
+SELECT count(*) FROM pr_reviewers
+WHERE pr_id = $1
+`
+
+func (q *Queries) GetReviewerCountForPR(ctx context.Context, prID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, getReviewerCountForPR, prID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getReviewersForPR = `-- name: GetReviewersForPR :many
+SELECT users.id, users.name, users.is_active, users.team_id, users.skills, users.max_open_reviews, users.seniority
+FROM users
+JOIN pr_reviewers ON users.id = pr_reviewers.user_id
+WHERE pr_reviewers.pr_id = $1
+`
+
+func (q *Queries) GetReviewersForPR(ctx context.Context, prID uuid.UUID) ([]User, error) {
+	rows, err := q.db.Query(ctx, getReviewersForPR, prID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.IsActive,
+			&i.TeamID,
+			&i.Skills,
+			&i.MaxOpenReviews,
+			&i.Seniority,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReviewerTeam = `-- name: GetReviewerTeam :one
+SELECT team_id FROM pr_reviewers
+WHERE pr_id = $1 AND user_id = $2
+`
+
+type GetReviewerTeamParams struct {
+	PrID   uuid.UUID `json:"pr_id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetReviewerTeam(ctx context.Context, arg GetReviewerTeamParams) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, getReviewerTeam, arg.PrID, arg.UserID)
+	var team_id pgtype.UUID
+	err := row.Scan(&team_id)
+	return team_id, err
+}
+
+const getReviewVerdicts = `-- name: GetReviewVerdicts :many
+SELECT user_id, verdict, verdict_at
+FROM pr_reviewers
+WHERE pr_id = $1 AND verdict IS NOT NULL
+ORDER BY verdict_at, user_id
+`
+
+type GetReviewVerdictsRow struct {
+	UserID    uuid.UUID          `json:"user_id"`
+	Verdict   pgtype.Text        `json:"verdict"`
+	VerdictAt pgtype.Timestamptz `json:"verdict_at"`
+}
+
+// решения ревьюверов PR в порядке их отправки
+func (q *Queries) GetReviewVerdicts(ctx context.Context, prID uuid.UUID) ([]GetReviewVerdictsRow, error) {
+	rows, err := q.db.Query(ctx, getReviewVerdicts, prID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetReviewVerdictsRow
+	for rows.Next() {
+		var i GetReviewVerdictsRow
+		if err := rows.Scan(&i.UserID, &i.Verdict, &i.VerdictAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTeam = `-- name: GetTeam :one
+SELECT id, name, assignment_strategy, reviewers_count, max_open_reviews, require_senior, juniors_not_alone, parent_id, min_approvals, block_on_changes_requested FROM teams
+WHERE id = $1
 `
 
 func (q *Queries) GetTeam(ctx context.Context, id uuid.UUID) (Team, error) {
 	row := q.db.QueryRow(ctx, getTeam, id)
 	var i Team
-	err := row.Scan(&i.ID, &i.Name)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AssignmentStrategy,
+		&i.ReviewersCount,
+		&i.MaxOpenReviews,
+		&i.RequireSenior,
+		&i.JuniorsNotAlone,
+		&i.ParentID,
+		&i.MinApprovals,
+		&i.BlockOnChangesRequested,
+	)
+	return i, err
+}
+
+const getTeamByName = `-- name: GetTeamByName :one
+SELECT id, name, assignment_strategy, reviewers_count, max_open_reviews, require_senior, juniors_not_alone, parent_id, min_approvals, block_on_changes_requested FROM teams
+WHERE name = $1
+`
+
+func (q *Queries) GetTeamByName(ctx context.Context, name string) (Team, error) {
+	row := q.db.QueryRow(ctx, getTeamByName, name)
+	var i Team
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AssignmentStrategy,
+		&i.ReviewersCount,
+		&i.MaxOpenReviews,
+		&i.RequireSenior,
+		&i.JuniorsNotAlone,
+		&i.ParentID,
+		&i.MinApprovals,
+		&i.BlockOnChangesRequested,
+	)
 	return i, err
 }
 
-const getTeamByName = `-- name: GetTeamByName :one
-SELECT id, name FROM teams
-WHERE name = $1
+const getTeamFallbacks = `-- name: GetTeamFallbacks :many
+SELECT t.id, t.name, t.assignment_strategy, t.reviewers_count, t.max_open_reviews, t.require_senior, t.juniors_not_alone, t.parent_id, t.min_approvals, t.block_on_changes_requested FROM team_fallbacks tf
+JOIN teams t ON t.id = tf.fallback_team_id
+WHERE tf.team_id = $1
+ORDER BY tf.priority
+`
+
+// резервные команды в порядке приоритета
+func (q *Queries) GetTeamFallbacks(ctx context.Context, teamID uuid.UUID) ([]Team, error) {
+	rows, err := q.db.Query(ctx, getTeamFallbacks, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Team
+	for rows.Next() {
+		var i Team
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.AssignmentStrategy,
+			&i.ReviewersCount,
+			&i.MaxOpenReviews,
+			&i.RequireSenior,
+			&i.JuniorsNotAlone,
+			&i.ParentID,
+			&i.MinApprovals,
+			&i.BlockOnChangesRequested,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTeamMemberRole = `-- name: GetTeamMemberRole :one
+SELECT role FROM team_members
+WHERE team_id = $1 AND user_id = $2
+`
+
+type GetTeamMemberRoleParams struct {
+	TeamID uuid.UUID `json:"team_id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// роль участника в команде; нет строки - не участник
+func (q *Queries) GetTeamMemberRole(ctx context.Context, arg GetTeamMemberRoleParams) (pgtype.Text, error) {
+	row := q.db.QueryRow(ctx, getTeamMemberRole, arg.TeamID, arg.UserID)
+	var role pgtype.Text
+	err := row.Scan(&role)
+	return role, err
+}
+
+const getTeamMembers = `-- name: GetTeamMembers :many
+SELECT users.id, users.name, users.is_active, users.team_id, users.skills, users.max_open_reviews, users.seniority, tm.role
+FROM team_members tm
+JOIN users ON users.id = tm.user_id
+WHERE tm.team_id = $1
+ORDER BY users.name
+`
+
+type GetTeamMembersRow struct {
+	ID             uuid.UUID   `json:"id"`
+	Name           string      `json:"name"`
+	IsActive       bool        `json:"is_active"`
+	TeamID         pgtype.UUID `json:"team_id"`
+	Skills         []string    `json:"skills"`
+	MaxOpenReviews pgtype.Int4 `json:"max_open_reviews"`
+	Seniority      string      `json:"seniority"`
+	Role           pgtype.Text `json:"role"`
+}
+
+// участники команды с их ролями в ней
+func (q *Queries) GetTeamMembers(ctx context.Context, teamID uuid.UUID) ([]GetTeamMembersRow, error) {
+	rows, err := q.db.Query(ctx, getTeamMembers, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTeamMembersRow
+	for rows.Next() {
+		var i GetTeamMembersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.IsActive,
+			&i.TeamID,
+			&i.Skills,
+			&i.MaxOpenReviews,
+			&i.Seniority,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTeamMembersAvailability = `-- name: GetTeamMembersAvailability :many
+SELECT tm.team_id, u1.id, u1.name, u1.is_active,
+       EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+       ) AS is_absent,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM team_members tm
+JOIN users u1 ON u1.id = tm.user_id
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = tm.team_id
+WHERE tm.team_id = ANY($1::uuid[])
+ORDER BY u1.name
+`
+
+type GetTeamMembersAvailabilityRow struct {
+	TeamID         uuid.UUID   `json:"team_id"`
+	ID             uuid.UUID   `json:"id"`
+	Name           string      `json:"name"`
+	IsActive       bool        `json:"is_active"`
+	IsAbsent       bool        `json:"is_absent"`
+	OpenReviews    int64       `json:"open_reviews"`
+	MaxOpenReviews pgtype.Int4 `json:"max_open_reviews"`
+}
+
+// все участники команд с признаками доступности: объясняет, почему кандидат не может быть назначен
+func (q *Queries) GetTeamMembersAvailability(ctx context.Context, teamIds []uuid.UUID) ([]GetTeamMembersAvailabilityRow, error) {
+	rows, err := q.db.Query(ctx, getTeamMembersAvailability, teamIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTeamMembersAvailabilityRow
+	for rows.Next() {
+		var i GetTeamMembersAvailabilityRow
+		if err := rows.Scan(
+			&i.TeamID,
+			&i.ID,
+			&i.Name,
+			&i.IsActive,
+			&i.IsAbsent,
+			&i.OpenReviews,
+			&i.MaxOpenReviews,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnderstaffedPullRequests = `-- name: GetUnderstaffedPullRequests :many
+SELECT pr.id, pr.title, pr.author_id, pr.required_skills, pr.target_reviewers, pr.team_id,
+       pr.created_at, pr.updated_at,
+       COALESCE(array_agg(prr.user_id ORDER BY prr.user_id) FILTER (WHERE prr.user_id IS NOT NULL), '{}')::uuid[] AS reviewer_ids,
+       COALESCE(array_agg(u.seniority ORDER BY prr.user_id) FILTER (WHERE prr.user_id IS NOT NULL), '{}')::text[] AS reviewer_seniorities,
+       COALESCE(t.require_senior, false)::bool AS require_senior,
+       COALESCE(t.juniors_not_alone, false)::bool AS juniors_not_alone
+FROM pull_requests pr
+LEFT JOIN pr_reviewers prr ON prr.pr_id = pr.id
+LEFT JOIN users u ON u.id = prr.user_id
+LEFT JOIN teams t ON t.id = pr.team_id
+WHERE pr.status = 'OPEN'
+  AND (cardinality($1::uuid[]) = 0 OR pr.team_id = ANY($1::uuid[]))
+  AND (cardinality($2::uuid[]) = 0 OR pr.id = ANY($2::uuid[]))
+GROUP BY pr.id, t.id
+HAVING COUNT(prr.user_id) < pr.target_reviewers
+ORDER BY pr.created_at, pr.id
 `
 
-func (q *Queries) GetTeamByName(ctx context.Context, name string) (Team, error) {
-	row := q.db.QueryRow(ctx, getTeamByName, name)
-	var i Team
-	err := row.Scan(&i.ID, &i.Name)
-	return i, err
+type GetUnderstaffedPullRequestsParams struct {
+	TeamIds []uuid.UUID `json:"team_ids"`
+	PrIds   []uuid.UUID `json:"pr_ids"`
+}
+
+type GetUnderstaffedPullRequestsRow struct {
+	ID                  uuid.UUID          `json:"id"`
+	Title               string             `json:"title"`
+	AuthorID            uuid.UUID          `json:"author_id"`
+	RequiredSkills      []string           `json:"required_skills"`
+	TargetReviewers     int32              `json:"target_reviewers"`
+	TeamID              pgtype.UUID        `json:"team_id"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt           pgtype.Timestamptz `json:"updated_at"`
+	ReviewerIds         []uuid.UUID        `json:"reviewer_ids"`
+	ReviewerSeniorities []string           `json:"reviewer_seniorities"`
+	RequireSenior       bool               `json:"require_senior"`
+	JuniorsNotAlone     bool               `json:"juniors_not_alone"`
+}
+
+// OPEN PR, у которых ревьюверов меньше целевого числа, от старых к новым, с уровнями
+// ревьюверов и правилами состава команды PR; пустые team_ids и pr_ids - без ограничения
+func (q *Queries) GetUnderstaffedPullRequests(ctx context.Context, arg GetUnderstaffedPullRequestsParams) ([]GetUnderstaffedPullRequestsRow, error) {
+	rows, err := q.db.Query(ctx, getUnderstaffedPullRequests, arg.TeamIds, arg.PrIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnderstaffedPullRequestsRow
+	for rows.Next() {
+		var i GetUnderstaffedPullRequestsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.AuthorID,
+			&i.RequiredSkills,
+			&i.TargetReviewers,
+			&i.TeamID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ReviewerIds,
+			&i.ReviewerSeniorities,
+			&i.RequireSenior,
+			&i.JuniorsNotAlone,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, name, is_active, team_id FROM users
+SELECT id, name, is_active, team_id, skills, max_open_reviews, seniority FROM users
 WHERE id = $1
 `
 
@@ -409,29 +1728,41 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Name,
 		&i.IsActive,
 		&i.TeamID,
+		&i.Skills,
+		&i.MaxOpenReviews,
+		&i.Seniority,
 	)
 	return i, err
 }
 
-const getUsersByTeamID = `-- name: GetUsersByTeamID :many
-SELECT id, name, is_active, team_id FROM users
-WHERE team_id = $1
+const getUserTeams = `-- name: GetUserTeams :many
+SELECT t.id, t.name, t.assignment_strategy, t.reviewers_count, t.max_open_reviews, t.require_senior, t.juniors_not_alone, t.parent_id, t.min_approvals, t.block_on_changes_requested FROM team_members tm
+JOIN teams t ON t.id = tm.team_id
+WHERE tm.user_id = $1
+ORDER BY t.name
 `
 
-func (q *Queries) GetUsersByTeamID(ctx context.Context, teamID pgtype.UUID) ([]User, error) {
-	rows, err := q.db.Query(ctx, getUsersByTeamID, teamID)
+// команды, в которых состоит пользователь, по имени
+func (q *Queries) GetUserTeams(ctx context.Context, userID uuid.UUID) ([]Team, error) {
+	rows, err := q.db.Query(ctx, getUserTeams, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []User
+	var items []Team
 	for rows.Next() {
-		var i User
+		var i Team
 		if err := rows.Scan(
 			&i.ID,
 			&i.Name,
-			&i.IsActive,
-			&i.TeamID,
+			&i.AssignmentStrategy,
+			&i.ReviewersCount,
+			&i.MaxOpenReviews,
+			&i.RequireSenior,
+			&i.JuniorsNotAlone,
+			&i.ParentID,
+			&i.MinApprovals,
+			&i.BlockOnChangesRequested,
 		); err != nil {
 			return nil, err
 		}
@@ -443,6 +1774,142 @@ func (q *Queries) GetUsersByTeamID(ctx context.Context, teamID pgtype.UUID) ([]U
 	return items, nil
 }
 
+const mergePullRequest = `-- name: MergePullRequest :one
+UPDATE pull_requests
+SET status = 'MERGED', merge_forced = $2, merge_forced_by = $3, merge_violations = $4, merged_at = COALESCE(merged_at, NOW()), updated_at = NOW()
+WHERE id = $1 AND status = 'OPEN'
+RETURNING id, title, author_id, status, created_at, updated_at, required_skills, target_reviewers, team_id, merge_forced, merged_at, merge_forced_by, merge_violations
+`
+
+type MergePullRequestParams struct {
+	ID              uuid.UUID   `json:"id"`
+	MergeForced     bool        `json:"merge_forced"`
+	MergeForcedBy   pgtype.UUID `json:"merge_forced_by"`
+	MergeViolations []string    `json:"merge_violations"`
+}
+
+// merge_forced - слияние в обход политики команды: кто слил (merge_forced_by) и что нарушено
+// (merge_violations); сливается только открытый PR
+func (q *Queries) MergePullRequest(ctx context.Context, arg MergePullRequestParams) (PullRequest, error) {
+	row := q.db.QueryRow(ctx, mergePullRequest,
+		arg.ID,
+		arg.MergeForced,
+		arg.MergeForcedBy,
+		arg.MergeViolations,
+	)
+	var i PullRequest
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.AuthorID,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RequiredSkills,
+		&i.TargetReviewers,
+		&i.TeamID,
+		&i.MergeForced,
+		&i.MergedAt,
+		&i.MergeForcedBy,
+		&i.MergeViolations,
+	)
+	return i, err
+}
+
+const recordAssignments = `-- name: RecordAssignments :exec
+INSERT INTO pr_assignments (pr_id, user_id, reason, replaced_user_id, team_id, strategy, inputs)
+SELECT a.pr_id, a.user_id, a.reason,
+       NULLIF(a.replaced_user_id, '00000000-0000-0000-0000-000000000000'),
+       NULLIF(a.team_id, '00000000-0000-0000-0000-000000000000'),
+       NULLIF(a.strategy, ''),
+       a.inputs
+FROM unnest(
+    $1::uuid[],
+    $2::uuid[],
+    $3::text[],
+    $4::uuid[],
+    $5::uuid[],
+    $6::text[],
+    $7::jsonb[]
+) AS a(pr_id, user_id, reason, replaced_user_id, team_id, strategy, inputs)
+`
+
+type RecordAssignmentsParams struct {
+	PrIds           []uuid.UUID `json:"pr_ids"`
+	UserIds         []uuid.UUID `json:"user_ids"`
+	Reasons         []string    `json:"reasons"`
+	ReplacedUserIds []uuid.UUID `json:"replaced_user_ids"`
+	TeamIds         []uuid.UUID `json:"team_ids"`
+	Strategies      []string    `json:"strategies"`
+	Inputs          [][]byte    `json:"inputs"`
+}
+
+// записывает назначения (pr_ids[i], user_ids[i], ...); нулевой uuid и пустая строка - NULL
+func (q *Queries) RecordAssignments(ctx context.Context, arg RecordAssignmentsParams) error {
+	_, err := q.db.Exec(ctx, recordAssignments,
+		arg.PrIds,
+		arg.UserIds,
+		arg.Reasons,
+		arg.ReplacedUserIds,
+		arg.TeamIds,
+		arg.Strategies,
+		arg.Inputs,
+	)
+	return err
+}
+
+const recordPREvents = `-- name: RecordPREvents :exec
+INSERT INTO pr_events (pr_id, event_type, actor_id, actor_kind, user_id, replaced_user_id, from_status, to_status, details)
+SELECT e.pr_id, e.event_type,
+       NULLIF(e.actor_id, '00000000-0000-0000-0000-000000000000'),
+       e.actor_kind,
+       NULLIF(e.user_id, '00000000-0000-0000-0000-000000000000'),
+       NULLIF(e.replaced_user_id, '00000000-0000-0000-0000-000000000000'),
+       NULLIF(e.from_status, ''),
+       NULLIF(e.to_status, ''),
+       e.details
+FROM unnest(
+    $1::uuid[],
+    $2::text[],
+    $3::uuid[],
+    $4::text[],
+    $5::uuid[],
+    $6::uuid[],
+    $7::text[],
+    $8::text[],
+    $9::jsonb[]
+) WITH ORDINALITY AS e(pr_id, event_type, actor_id, actor_kind, user_id, replaced_user_id, from_status, to_status, details, ord)
+ORDER BY e.ord
+`
+
+type RecordPREventsParams struct {
+	PrIds           []uuid.UUID `json:"pr_ids"`
+	EventTypes      []string    `json:"event_types"`
+	ActorIds        []uuid.UUID `json:"actor_ids"`
+	ActorKinds      []string    `json:"actor_kinds"`
+	UserIds         []uuid.UUID `json:"user_ids"`
+	ReplacedUserIds []uuid.UUID `json:"replaced_user_ids"`
+	FromStatuses    []string    `json:"from_statuses"`
+	ToStatuses      []string    `json:"to_statuses"`
+	Details         [][]byte    `json:"details"`
+}
+
+// добавляет события (pr_ids[i], event_types[i], ...); нулевой uuid и пустая строка - NULL
+func (q *Queries) RecordPREvents(ctx context.Context, arg RecordPREventsParams) error {
+	_, err := q.db.Exec(ctx, recordPREvents,
+		arg.PrIds,
+		arg.EventTypes,
+		arg.ActorIds,
+		arg.ActorKinds,
+		arg.UserIds,
+		arg.ReplacedUserIds,
+		arg.FromStatuses,
+		arg.ToStatuses,
+		arg.Details,
+	)
+	return err
+}
+
 const removeReviewerFromPR = `-- name: RemoveReviewerFromPR :exec
 DELETE FROM pr_reviewers
 WHERE pr_id = $1 AND user_id = $2
@@ -458,6 +1925,127 @@ func (q *Queries) RemoveReviewerFromPR(ctx context.Context, arg RemoveReviewerFr
 	return err
 }
 
+const removeReviewersFromOpenPRs = `-- name: RemoveReviewersFromOpenPRs :many
+DELETE FROM pr_reviewers prr
+USING pull_requests pr
+WHERE pr.id = prr.pr_id
+  AND pr.status = 'OPEN'
+  AND prr.user_id = ANY($1::uuid[])
+RETURNING prr.pr_id, prr.user_id, prr.team_id
+`
+
+type RemoveReviewersFromOpenPRsRow struct {
+	PrID   uuid.UUID   `json:"pr_id"`
+	UserID uuid.UUID   `json:"user_id"`
+	TeamID pgtype.UUID `json:"team_id"`
+}
+
+// снимает пользователей со всех OPEN PR и возвращает снятые назначения
+func (q *Queries) RemoveReviewersFromOpenPRs(ctx context.Context, userIds []uuid.UUID) ([]RemoveReviewersFromOpenPRsRow, error) {
+	rows, err := q.db.Query(ctx, removeReviewersFromOpenPRs, userIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RemoveReviewersFromOpenPRsRow
+	for rows.Next() {
+		var i RemoveReviewersFromOpenPRsRow
+		if err := rows.Scan(&i.PrID, &i.UserID, &i.TeamID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const removeTeamMember = `-- name: RemoveTeamMember :execrows
+DELETE FROM team_members
+WHERE team_id = $1 AND user_id = $2
+`
+
+type RemoveTeamMemberParams struct {
+	TeamID uuid.UUID `json:"team_id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) RemoveTeamMember(ctx context.Context, arg RemoveTeamMemberParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeTeamMember, arg.TeamID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setPullRequestTargetReviewers = `-- name: SetPullRequestTargetReviewers :exec
+UPDATE pull_requests
+SET target_reviewers = $2
+WHERE id = $1
+`
+
+type SetPullRequestTargetReviewersParams struct {
+	ID              uuid.UUID `json:"id"`
+	TargetReviewers int32     `json:"target_reviewers"`
+}
+
+func (q *Queries) SetPullRequestTargetReviewers(ctx context.Context, arg SetPullRequestTargetReviewersParams) error {
+	_, err := q.db.Exec(ctx, setPullRequestTargetReviewers, arg.ID, arg.TargetReviewers)
+	return err
+}
+
+const setReviewVerdict = `-- name: SetReviewVerdict :execrows
+UPDATE pr_reviewers
+SET verdict = $3, verdict_at = NOW()
+WHERE pr_id = $1 AND user_id = $2
+`
+
+type SetReviewVerdictParams struct {
+	PrID    uuid.UUID   `json:"pr_id"`
+	UserID  uuid.UUID   `json:"user_id"`
+	Verdict pgtype.Text `json:"verdict"`
+}
+
+// сохраняет решение ревьювера; 0 строк - пользователь не назначен на PR
+func (q *Queries) SetReviewVerdict(ctx context.Context, arg SetReviewVerdictParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setReviewVerdict, arg.PrID, arg.UserID, arg.Verdict)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setTeamParent = `-- name: SetTeamParent :one
+UPDATE teams
+SET parent_id = $2
+WHERE id = $1
+RETURNING id, name, assignment_strategy, reviewers_count, max_open_reviews, require_senior, juniors_not_alone, parent_id, min_approvals, block_on_changes_requested
+`
+
+type SetTeamParentParams struct {
+	ID       uuid.UUID   `json:"id"`
+	ParentID pgtype.UUID `json:"parent_id"`
+}
+
+func (q *Queries) SetTeamParent(ctx context.Context, arg SetTeamParentParams) (Team, error) {
+	row := q.db.QueryRow(ctx, setTeamParent, arg.ID, arg.ParentID)
+	var i Team
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AssignmentStrategy,
+		&i.ReviewersCount,
+		&i.MaxOpenReviews,
+		&i.RequireSenior,
+		&i.JuniorsNotAlone,
+		&i.ParentID,
+		&i.MinApprovals,
+		&i.BlockOnChangesRequested,
+	)
+	return i, err
+}
+
 const setUserActive = `-- name: SetUserActive :exec
 UPDATE users
 SET is_active = $2
@@ -474,11 +2062,160 @@ func (q *Queries) SetUserActive(ctx context.Context, arg SetUserActiveParams) er
 	return err
 }
 
+const setUserMaxOpenReviews = `-- name: SetUserMaxOpenReviews :one
+UPDATE users
+SET max_open_reviews = $2
+WHERE id = $1
+RETURNING id, name, is_active, team_id, skills, max_open_reviews, seniority
+`
+
+type SetUserMaxOpenReviewsParams struct {
+	ID             uuid.UUID   `json:"id"`
+	MaxOpenReviews pgtype.Int4 `json:"max_open_reviews"`
+}
+
+func (q *Queries) SetUserMaxOpenReviews(ctx context.Context, arg SetUserMaxOpenReviewsParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserMaxOpenReviews, arg.ID, arg.MaxOpenReviews)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.IsActive,
+		&i.TeamID,
+		&i.Skills,
+		&i.MaxOpenReviews,
+		&i.Seniority,
+	)
+	return i, err
+}
+
+const setUserPrimaryTeam = `-- name: SetUserPrimaryTeam :one
+UPDATE users
+SET team_id = $2
+WHERE id = $1
+RETURNING id, name, is_active, team_id, skills, max_open_reviews, seniority
+`
+
+type SetUserPrimaryTeamParams struct {
+	ID     uuid.UUID   `json:"id"`
+	TeamID pgtype.UUID `json:"team_id"`
+}
+
+func (q *Queries) SetUserPrimaryTeam(ctx context.Context, arg SetUserPrimaryTeamParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserPrimaryTeam, arg.ID, arg.TeamID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.IsActive,
+		&i.TeamID,
+		&i.Skills,
+		&i.MaxOpenReviews,
+		&i.Seniority,
+	)
+	return i, err
+}
+
+const setUserSeniority = `-- name: SetUserSeniority :one
+UPDATE users
+SET seniority = $2
+WHERE id = $1
+RETURNING id, name, is_active, team_id, skills, max_open_reviews, seniority
+`
+
+type SetUserSeniorityParams struct {
+	ID        uuid.UUID `json:"id"`
+	Seniority string    `json:"seniority"`
+}
+
+func (q *Queries) SetUserSeniority(ctx context.Context, arg SetUserSeniorityParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserSeniority, arg.ID, arg.Seniority)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.IsActive,
+		&i.TeamID,
+		&i.Skills,
+		&i.MaxOpenReviews,
+		&i.Seniority,
+	)
+	return i, err
+}
+
+const setUserSkills = `-- name: SetUserSkills :one
+UPDATE users
+SET skills = $2
+WHERE id = $1
+RETURNING id, name, is_active, team_id, skills, max_open_reviews, seniority
+`
+
+type SetUserSkillsParams struct {
+	ID     uuid.UUID `json:"id"`
+	Skills []string  `json:"skills"`
+}
+
+func (q *Queries) SetUserSkills(ctx context.Context, arg SetUserSkillsParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserSkills, arg.ID, arg.Skills)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.IsActive,
+		&i.TeamID,
+		&i.Skills,
+		&i.MaxOpenReviews,
+		&i.Seniority,
+	)
+	return i, err
+}
+
+const touchPullRequest = `-- name: TouchPullRequest :one
+UPDATE pull_requests
+SET updated_at = NOW()
+WHERE id = $1
+RETURNING id, title, author_id, status, created_at, updated_at, required_skills, target_reviewers, team_id, merge_forced, merged_at, merge_forced_by, merge_violations
+`
+
+// отмечает изменение PR, не меняя его статус (ревьюверы, решения)
+func (q *Queries) TouchPullRequest(ctx context.Context, id uuid.UUID) (PullRequest, error) {
+	row := q.db.QueryRow(ctx, touchPullRequest, id)
+	var i PullRequest
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.AuthorID,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RequiredSkills,
+		&i.TargetReviewers,
+		&i.TeamID,
+		&i.MergeForced,
+		&i.MergedAt,
+		&i.MergeForcedBy,
+		&i.MergeViolations,
+	)
+	return i, err
+}
+
+const touchPullRequests = `-- name: TouchPullRequests :exec
+UPDATE pull_requests
+SET updated_at = NOW()
+WHERE id = ANY($1::uuid[])
+`
+
+// то же для набора PR (массовые переназначения и добор)
+func (q *Queries) TouchPullRequests(ctx context.Context, ids []uuid.UUID) error {
+	_, err := q.db.Exec(ctx, touchPullRequests, ids)
+	return err
+}
+
 const updatePullRequestStatus = `-- name: UpdatePullRequestStatus :one
 UPDATE pull_requests
 SET status = $2, updated_at = NOW()
 WHERE id = $1
-RETURNING id, title, author_id, status, created_at, updated_at
+RETURNING id, title, author_id, status, created_at, updated_at, required_skills, target_reviewers, team_id, merge_forced, merged_at, merge_forced_by, merge_violations
 `
 
 type UpdatePullRequestStatusParams struct {
@@ -496,6 +2233,68 @@ func (q *Queries) UpdatePullRequestStatus(ctx context.Context, arg UpdatePullReq
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RequiredSkills,
+		&i.TargetReviewers,
+		&i.TeamID,
+		&i.MergeForced,
+		&i.MergedAt,
+		&i.MergeForcedBy,
+		&i.MergeViolations,
+	)
+	return i, err
+}
+
+const updateTeamSettings = `-- name: UpdateTeamSettings :one
+UPDATE teams
+SET assignment_strategy = COALESCE($1, assignment_strategy),
+    reviewers_count = COALESCE($2, reviewers_count),
+    max_open_reviews = CASE WHEN $3::bool
+                            THEN $4
+                            ELSE max_open_reviews END,
+    require_senior = COALESCE($5, require_senior),
+    juniors_not_alone = COALESCE($6, juniors_not_alone),
+    min_approvals = COALESCE($7, min_approvals),
+    block_on_changes_requested = COALESCE($8, block_on_changes_requested)
+WHERE id = $9
+RETURNING id, name, assignment_strategy, reviewers_count, max_open_reviews, require_senior, juniors_not_alone, parent_id, min_approvals, block_on_changes_requested
+`
+
+type UpdateTeamSettingsParams struct {
+	AssignmentStrategy      pgtype.Text `json:"assignment_strategy"`
+	ReviewersCount          pgtype.Int4 `json:"reviewers_count"`
+	SetMaxOpenReviews       bool        `json:"set_max_open_reviews"`
+	MaxOpenReviews          pgtype.Int4 `json:"max_open_reviews"`
+	RequireSenior           pgtype.Bool `json:"require_senior"`
+	JuniorsNotAlone         pgtype.Bool `json:"juniors_not_alone"`
+	MinApprovals            pgtype.Int4 `json:"min_approvals"`
+	BlockOnChangesRequested pgtype.Bool `json:"block_on_changes_requested"`
+	ID                      uuid.UUID   `json:"id"`
+}
+
+func (q *Queries) UpdateTeamSettings(ctx context.Context, arg UpdateTeamSettingsParams) (Team, error) {
+	row := q.db.QueryRow(ctx, updateTeamSettings,
+		arg.AssignmentStrategy,
+		arg.ReviewersCount,
+		arg.SetMaxOpenReviews,
+		arg.MaxOpenReviews,
+		arg.RequireSenior,
+		arg.JuniorsNotAlone,
+		arg.MinApprovals,
+		arg.BlockOnChangesRequested,
+		arg.ID,
+	)
+	var i Team
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AssignmentStrategy,
+		&i.ReviewersCount,
+		&i.MaxOpenReviews,
+		&i.RequireSenior,
+		&i.JuniorsNotAlone,
+		&i.ParentID,
+		&i.MinApprovals,
+		&i.BlockOnChangesRequested,
 	)
 	return i, err
 }
@@ -506,9 +2305,12 @@ VALUES ($1, $2, $3, $4)
 ON CONFLICT (id) DO UPDATE
     SET
     name = EXCLUDED.name,
-    team_id = EXCLUDED.team_id,
-    is_active = EXCLUDED.is_active
-RETURNING id, name, is_active, team_id
+    team_id = COALESCE(users.team_id, EXCLUDED.team_id),
+    is_active = CASE WHEN EXISTS (
+                    SELECT 1 FROM team_members tm
+                    WHERE tm.user_id = users.id AND tm.team_id IS DISTINCT FROM EXCLUDED.team_id
+                ) THEN users.is_active ELSE EXCLUDED.is_active END
+RETURNING id, name, is_active, team_id, skills, max_open_reviews, seniority
 `
 
 type UpsertUserParams struct {
@@ -518,6 +2320,8 @@ type UpsertUserParams struct {
 	IsActive bool        `json:"is_active"`
 }
 
+// основная команда уже существующего пользователя не меняется: участие в других командах
+// хранится в team_members; активность меняется, только если других команд у него нет
 func (q *Queries) UpsertUser(ctx context.Context, arg UpsertUserParams) (User, error) {
 	row := q.db.QueryRow(ctx, upsertUser,
 		arg.ID,
@@ -531,6 +2335,9 @@ func (q *Queries) UpsertUser(ctx context.Context, arg UpsertUserParams) (User, e
 		&i.Name,
 		&i.IsActive,
 		&i.TeamID,
+		&i.Skills,
+		&i.MaxOpenReviews,
+		&i.Seniority,
 	)
 	return i, err
 }
@@ -2,12 +2,16 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/Narotan/pr-reviewer-service/internal/db"
 	"github.com/Narotan/pr-reviewer-service/internal/service"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/rs/zerolog"
 )
@@ -15,14 +19,42 @@ import (
 type Service interface {
 	CreateTeam(ctx context.Context, name string) (db.Team, error)
 	CreateTeamWithMembers(ctx context.Context, teamName string, members []service.TeamMemberDetails) (*service.TeamDetails, error)
-	GetTeamDetails(ctx context.Context, teamName string) (*service.TeamDetails, error)
-	SetUserActiveStatus(ctx context.Context, userID uuid.UUID, isActive bool) (*service.UserDetails, error)
-	CreatePullRequest(ctx context.Context, prID, title, authorID string) (*service.PRDetails, error)
-	UpdatePRStatusToMerged(ctx context.Context, prID string) (*service.PRDetails, error)
-	GetOpenPRsForReviewer(ctx context.Context, userID uuid.UUID) ([]service.PRShort, error)
-	ReassignReviewer(ctx context.Context, prID string, oldReviewerID string) (*service.PRDetails, error)
+	GetTeamDetails(ctx context.Context, teamName string, includeSubTeams bool) (*service.TeamDetails, error)
+	SetTeamParent(ctx context.Context, teamName, parentName string) (*service.TeamDetails, error)
+	AddTeamMember(ctx context.Context, teamName string, userID uuid.UUID, role string) (*service.TeamDetails, error)
+	RemoveTeamMember(ctx context.Context, teamName string, userID uuid.UUID) (*service.TeamDetails, error)
+	SetPrimaryTeam(ctx context.Context, userID uuid.UUID, teamName string) (*service.UserDetails, error)
+	GetTeamSettings(ctx context.Context, teamName string) (*service.TeamSettings, error)
+	UpdateTeamSettings(ctx context.Context, teamName string, upd service.TeamSettingsUpdate) (*service.TeamSettings, error)
+	DeactivateTeam(ctx context.Context, teamName string, userIDs []uuid.UUID) (*service.DeactivationResult, error)
+	GetOwnershipRules(ctx context.Context, teamName, repository string) (*service.OwnershipRuleset, error)
+	SetOwnershipRules(ctx context.Context, ruleset service.OwnershipRuleset) (*service.OwnershipRuleset, error)
+	SetUserActiveStatus(ctx context.Context, userID uuid.UUID, isActive bool, reassign bool) (*service.UserDetails, error)
+	SetUserSkills(ctx context.Context, userID uuid.UUID, skills []string) (*service.UserDetails, error)
+	SetUserMaxOpenReviews(ctx context.Context, userID uuid.UUID, limit *int) (*service.UserDetails, error)
+	SetUserSeniority(ctx context.Context, userID uuid.UUID, seniority string) (*service.UserDetails, error)
+	AddAbsence(ctx context.Context, userID uuid.UUID, startsAt, endsAt time.Time, reason string) (*service.Absence, error)
+	GetAbsences(ctx context.Context, userID uuid.UUID) ([]service.Absence, error)
+	DeleteAbsence(ctx context.Context, absenceID uuid.UUID) error
+	CreatePullRequest(ctx context.Context, prID, title, authorID string, opts service.CreatePROptions) (*service.PRDetails, error)
+	PreviewAssignment(ctx context.Context, authorID string, opts service.CreatePROptions) (*service.AssignmentPreview, error)
+	UpdatePRStatusToMerged(ctx context.Context, prID string, force bool) (*service.PRDetails, error)
+	GetOpenPRsForReviewer(ctx context.Context, userID uuid.UUID, pendingOnly bool) ([]service.PRShort, error)
+	SubmitReview(ctx context.Context, prID, userID, verdict string) (*service.PRDetails, error)
+	ReassignReviewer(ctx context.Context, prID string, oldReviewerID string, newReviewerID string) (*service.PRDetails, error)
+	AddReviewer(ctx context.Context, prID string, userID string) (*service.PRDetails, error)
+	GetUnderstaffedPRs(ctx context.Context) ([]service.UnderstaffedPR, error)
+	RemoveReviewer(ctx context.Context, prID string, userID string) (*service.PRDetails, error)
+	MarkPullRequestReady(ctx context.Context, prID string, opts service.CreatePROptions) (*service.PRDetails, error)
+	ClosePullRequest(ctx context.Context, prID string) (*service.PRDetails, error)
+	ReopenPullRequest(ctx context.Context, prID string) (*service.PRDetails, error)
+	GetPullRequest(ctx context.Context, prID string) (*service.PRDetails, error)
+	GetAssignmentRationale(ctx context.Context, prID string) ([]service.AssignmentRationale, error)
+	GetPRTimeline(ctx context.Context, prID string) ([]service.PREvent, error)
+	CheckActor(ctx context.Context, actorID uuid.UUID) error
 	// статистика
 	GetAssignmentStats(ctx context.Context) (*service.AssignmentStats, error)
+	GetPairStats(ctx context.Context) (*service.PairStats, error)
 }
 
 type Handler struct {
@@ -38,6 +70,36 @@ func NewHandler(service Service, log *zerolog.Logger) *Handler {
 	}
 }
 
+// заголовок с id пользователя, от имени которого выполняется запрос
+const actorHeader = "X-Actor-ID"
+
+// Actor передаёт в сервис пользователя из заголовка X-Actor-ID; он записывается в события PR.
+// Пользователь должен существовать. Без заголовка автор событий - unknown
+func (h *Handler) Actor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(actorHeader)
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		actorID, err := uuid.Parse(header)
+		if err != nil {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid "+actorHeader+" header")
+			return
+		}
+		if err := h.service.CheckActor(r.Context(), actorID); err != nil {
+			if strings.Contains(err.Error(), "NOT_FOUND") {
+				respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "unknown "+actorHeader+" user")
+				return
+			}
+			h.log.Error().Err(err).Msg("failed to check actor")
+			respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(service.WithActor(r.Context(), actorID)))
+	})
+}
+
 // структура запроса для команды
 type TeamRequest struct {
 	TeamName string                      `json:"team_name"`
@@ -50,6 +112,34 @@ type TeamResponse struct {
 	Members  []service.TeamMemberDetails `json:"members"`
 }
 
+// структура запроса для переноса команды в дереве; пустой parent_team_name делает её корневой
+type TeamParentRequest struct {
+	TeamName       string `json:"team_name"`
+	ParentTeamName string `json:"parent_team_name"`
+}
+
+// структура запроса для изменения настроек команды
+type TeamSettingsRequest struct {
+	TeamName           string  `json:"team_name"`
+	AssignmentStrategy *string `json:"assignment_strategy,omitempty"`
+	ReviewersCount     *int    `json:"reviewers_count,omitempty"`
+	// лимит открытых ревью участников по умолчанию; 0 снимает его
+	MaxOpenReviews  *int  `json:"max_open_reviews,omitempty"`
+	RequireSenior   *bool `json:"require_senior,omitempty"`
+	JuniorsNotAlone *bool `json:"juniors_not_alone,omitempty"`
+	// политика слияния; min_approvals = 0 снимает требование одобрений
+	MinApprovals            *int  `json:"min_approvals,omitempty"`
+	BlockOnChangesRequested *bool `json:"block_on_changes_requested,omitempty"`
+	// полный список резервных команд в порядке приоритета
+	FallbackTeams *[]string `json:"fallback_teams,omitempty"`
+}
+
+// структура запроса для массовой деактивации команды
+type TeamDeactivateRequest struct {
+	TeamName string   `json:"team_name"`
+	UserIDs  []string `json:"user_ids,omitempty"`
+}
+
 // структура ответа для пулл-реквеста
 type PullRequestResponse struct {
 	PullRequestID     string   `json:"pull_request_id"`
@@ -58,6 +148,7 @@ type PullRequestResponse struct {
 	Status            string   `json:"status"`
 	AssignedReviewers []string `json:"assigned_reviewers"`
 	CreatedAt         *string  `json:"createdAt,omitempty"`
+	UpdatedAt         *string  `json:"updatedAt,omitempty"`
 	MergedAt          *string  `json:"mergedAt,omitempty"`
 }
 
@@ -65,6 +156,48 @@ type PullRequestResponse struct {
 type SetUserActiveRequest struct {
 	UserID   string `json:"user_id"`
 	IsActive bool   `json:"is_active"`
+	// при деактивации переназначить OPEN ревью пользователя (по умолчанию да);
+	// false - для коротких отсутствий
+	ReassignReviews *bool `json:"reassign_reviews,omitempty"`
+}
+
+// структура запроса для установки навыков пользователя
+type SetUserSkillsRequest struct {
+	UserID string   `json:"user_id"`
+	Skills []string `json:"skills"`
+}
+
+// структура запроса для лимита открытых ревью; null - использовать лимит команды
+type SetUserMaxOpenReviewsRequest struct {
+	UserID         string `json:"user_id"`
+	MaxOpenReviews *int   `json:"max_open_reviews"`
+}
+
+// структура запроса для участия в команде; role необязательна
+type TeamMemberRequest struct {
+	TeamName string `json:"team_name"`
+	UserID   string `json:"user_id"`
+	Role     string `json:"role,omitempty"`
+}
+
+// структура запроса для выбора основной команды пользователя
+type SetPrimaryTeamRequest struct {
+	UserID   string `json:"user_id"`
+	TeamName string `json:"team_name"`
+}
+
+// структура запроса для уровня пользователя: junior, middle или senior
+type SetUserSeniorityRequest struct {
+	UserID    string `json:"user_id"`
+	Seniority string `json:"seniority"`
+}
+
+// структура запроса для добавления отсутствия (время в RFC 3339)
+type AddAbsenceRequest struct {
+	UserID   string    `json:"user_id"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Reason   string    `json:"reason,omitempty"`
 }
 
 // структура запроса для создания пулл-реквеста
@@ -72,6 +205,24 @@ type PullRequestRequest struct {
 	PullRequestID   string `json:"pull_request_id"`
 	PullRequestName string `json:"pull_request_name"`
 	AuthorID        string `json:"author_id"`
+	ReviewersCount  *int   `json:"reviewers_count,omitempty"`
+	// изменённые файлы для назначения владельцев кода
+	ChangedFiles []string `json:"changed_files,omitempty"`
+	Repository   string   `json:"repository,omitempty"`
+	// навыки, нужные для ревью (go, sql, frontend, ...)
+	RequiredSkills []string `json:"required_skills,omitempty"`
+	// команда автора, из которой подбирать ревьюверов; по умолчанию основная
+	TeamName string `json:"team_name,omitempty"`
+	// создать черновик без ревьюверов
+	Draft bool `json:"draft,omitempty"`
+}
+
+// структура запроса отметки черновика готовым к ревью
+type ReadyPullRequestRequest struct {
+	PullRequestID string `json:"pull_request_id"`
+	// изменённые файлы и репозиторий для назначения владельцев кода
+	ChangedFiles []string `json:"changed_files,omitempty"`
+	Repository   string   `json:"repository,omitempty"`
 }
 
 // структура короткого описания пулл-реквеста
@@ -132,6 +283,9 @@ func (h *Handler) CreateTeamWithMembers(w http.ResponseWriter, r *http.Request)
 			Members:  teamDetails.Members,
 		},
 	}
+	if len(teamDetails.ToppedUp) > 0 {
+		response["topped_up"] = teamDetails.ToppedUp
+	}
 	respondWithJSON(w, h.log, http.StatusCreated, response)
 }
 
@@ -142,7 +296,8 @@ func (h *Handler) GetTeam(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "team_name query missing")
 		return
 	}
-	td, err := h.service.GetTeamDetails(r.Context(), q)
+	includeSubTeams := r.URL.Query().Get("include_subteams") == "true"
+	td, err := h.service.GetTeamDetails(r.Context(), q, includeSubTeams)
 	if err != nil {
 		respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
 		return
@@ -150,167 +305,997 @@ func (h *Handler) GetTeam(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, h.log, http.StatusOK, td)
 }
 
-func (h *Handler) SetUserActiveStatus(w http.ResponseWriter, r *http.Request) {
-	var req SetUserActiveRequest
+func (h *Handler) GetTeamSettings(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("team_name")
+	if strings.TrimSpace(q) == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "team_name query missing")
+		return
+	}
+	settings, err := h.service.GetTeamSettings(r.Context(), q)
+	if err != nil {
+		respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"settings": settings})
+}
+
+func (h *Handler) UpdateTeamSettings(w http.ResponseWriter, r *http.Request) {
+	var req TeamSettingsRequest
 	if err := decodeJSON(w, r, &req); err != nil {
 		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
 		return
 	}
-	uid, err := uuid.Parse(req.UserID)
-	if err != nil {
-		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+
+	req.TeamName = strings.TrimSpace(req.TeamName)
+	if req.TeamName == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "team_name cannot be empty")
 		return
 	}
-	userDetails, err := h.service.SetUserActiveStatus(r.Context(), uid, req.IsActive)
+
+	settings, err := h.service.UpdateTeamSettings(r.Context(), req.TeamName, service.TeamSettingsUpdate{
+		AssignmentStrategy:      req.AssignmentStrategy,
+		ReviewersCount:          req.ReviewersCount,
+		MaxOpenReviews:          req.MaxOpenReviews,
+		RequireSenior:           req.RequireSenior,
+		JuniorsNotAlone:         req.JuniorsNotAlone,
+		MinApprovals:            req.MinApprovals,
+		BlockOnChangesRequested: req.BlockOnChangesRequested,
+		FallbackTeams:           req.FallbackTeams,
+	})
 	if err != nil {
-		respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "user not found")
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "FALLBACK_NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "fallback team not found")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
+			return
+		}
+		if strings.Contains(errMsg, "INVALID_FALLBACK") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "fallback_teams must not contain the team itself or duplicates")
+			return
+		}
+		if strings.Contains(errMsg, "INVALID_STRATEGY") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "unknown assignment_strategy")
+			return
+		}
+		if strings.Contains(errMsg, "INVALID_REVIEWERS_COUNT") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", strings.TrimPrefix(errMsg, "INVALID_REVIEWERS_COUNT: "))
+			return
+		}
+		if strings.Contains(errMsg, "INVALID_MAX_OPEN_REVIEWS") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "max_open_reviews must not be negative")
+			return
+		}
+		if strings.Contains(errMsg, "INVALID_MIN_APPROVALS") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "min_approvals must not be negative")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to update team settings")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
 		return
 	}
-	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"user": userDetails})
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"settings": settings})
 }
 
-func (h *Handler) GetPRsForUser(w http.ResponseWriter, r *http.Request) {
-	uidq := r.URL.Query().Get("user_id")
-	if uidq == "" {
-		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "user_id query missing")
+func (h *Handler) SetTeamParent(w http.ResponseWriter, r *http.Request) {
+	var req TeamParentRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
 		return
 	}
-	uid, err := uuid.Parse(uidq)
-	if err != nil {
-		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+
+	req.TeamName = strings.TrimSpace(req.TeamName)
+	req.ParentTeamName = strings.TrimSpace(req.ParentTeamName)
+	if req.TeamName == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "team_name cannot be empty")
 		return
 	}
-	prs, err := h.service.GetOpenPRsForReviewer(r.Context(), uid)
+
+	team, err := h.service.SetTeamParent(r.Context(), req.TeamName, req.ParentTeamName)
 	if err != nil {
-		h.log.Error().Err(err).Msg("failed to get PRs for user")
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "PARENT_NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "parent team not found")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
+			return
+		}
+		if strings.Contains(errMsg, "TEAM_CYCLE") {
+			respondWithError(w, h.log, http.StatusConflict, "TEAM_CYCLE", "parent team cannot be the team itself or one of its sub-teams")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to set team parent")
 		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
 		return
 	}
-	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{
-		"user_id":       uidq,
-		"pull_requests": prs,
-	})
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"team": team})
 }
 
-func (h *Handler) CreatePullRequest(w http.ResponseWriter, r *http.Request) {
-	var req PullRequestRequest
+func (h *Handler) AddTeamMember(w http.ResponseWriter, r *http.Request) {
+	h.changeTeamMember(w, r, true)
+}
+
+func (h *Handler) RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	h.changeTeamMember(w, r, false)
+}
+
+// общая часть добавления и удаления участника команды
+func (h *Handler) changeTeamMember(w http.ResponseWriter, r *http.Request, add bool) {
+	var req TeamMemberRequest
 	if err := decodeJSON(w, r, &req); err != nil {
 		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
 		return
 	}
+	req.TeamName = strings.TrimSpace(req.TeamName)
+	if req.TeamName == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "team_name cannot be empty")
+		return
+	}
+	uid, err := uuid.Parse(req.UserID)
+	if err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
 
-	if strings.TrimSpace(req.PullRequestID) == "" {
-		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id is required")
+	var team *service.TeamDetails
+	if add {
+		team, err = h.service.AddTeamMember(r.Context(), req.TeamName, uid, strings.TrimSpace(req.Role))
+	} else {
+		team, err = h.service.RemoveTeamMember(r.Context(), req.TeamName, uid)
+	}
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "USER_NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "user not found")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_MEMBER") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_MEMBER", "user is not a member of the team")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to change team membership")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
 		return
 	}
-	if strings.TrimSpace(req.PullRequestName) == "" {
-		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "pull_request_name is required")
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"team": team})
+}
+
+func (h *Handler) DeactivateTeam(w http.ResponseWriter, r *http.Request) {
+	var req TeamDeactivateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
 		return
 	}
-	if strings.TrimSpace(req.AuthorID) == "" {
-		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "author_id is required")
+
+	req.TeamName = strings.TrimSpace(req.TeamName)
+	if req.TeamName == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "team_name cannot be empty")
 		return
 	}
 
-	prDetails, err := h.service.CreatePullRequest(r.Context(), req.PullRequestID, req.PullRequestName, req.AuthorID)
+	userIDs := make([]uuid.UUID, 0, len(req.UserIDs))
+	for _, id := range req.UserIDs {
+		uid, err := uuid.Parse(id)
+		if err != nil {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format (must be UUID)")
+			return
+		}
+		userIDs = append(userIDs, uid)
+	}
+
+	result, err := h.service.DeactivateTeam(r.Context(), req.TeamName, userIDs)
 	if err != nil {
 		errMsg := err.Error()
-		if strings.Contains(errMsg, "PR_EXISTS") {
-			respondWithError(w, h.log, http.StatusConflict, "PR_EXISTS", "PR id already exists")
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
 			return
 		}
-		if strings.Contains(errMsg, "not found") {
-			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "author not found")
+		if strings.Contains(errMsg, "NOT_IN_TEAM") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "some user_ids are not members of the team")
 			return
 		}
-		h.log.Error().Err(err).Msg("failed to create pull request")
+		h.log.Error().Err(err).Msg("failed to deactivate team")
 		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
 		return
 	}
-
-	respondWithJSON(w, h.log, http.StatusCreated, map[string]interface{}{"pr": prDetails})
+	respondWithJSON(w, h.log, http.StatusOK, result)
 }
 
-func (h *Handler) MergePullRequest(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		PullRequestID string `json:"pull_request_id"`
+func (h *Handler) GetOwnershipRules(w http.ResponseWriter, r *http.Request) {
+	teamName := strings.TrimSpace(r.URL.Query().Get("team_name"))
+	repository := strings.TrimSpace(r.URL.Query().Get("repository"))
+	ruleset, err := h.service.GetOwnershipRules(r.Context(), teamName, repository)
+	if err != nil {
+		h.respondOwnershipError(w, err)
+		return
 	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"ownership": ruleset})
+}
+
+func (h *Handler) SetOwnershipRules(w http.ResponseWriter, r *http.Request) {
+	var req service.OwnershipRuleset
 	if err := decodeJSON(w, r, &req); err != nil {
 		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
 		return
 	}
+	req.TeamName = strings.TrimSpace(req.TeamName)
+	req.Repository = strings.TrimSpace(req.Repository)
 
-	if strings.TrimSpace(req.PullRequestID) == "" {
-		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id is required")
+	ruleset, err := h.service.SetOwnershipRules(r.Context(), req)
+	if err != nil {
+		h.respondOwnershipError(w, err)
 		return
 	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"ownership": ruleset})
+}
+
+func (h *Handler) respondOwnershipError(w http.ResponseWriter, err error) {
+	errMsg := err.Error()
+	switch {
+	case strings.Contains(errMsg, "INVALID_SCOPE"):
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "exactly one of team_name and repository is required")
+	case strings.Contains(errMsg, "INVALID_PATTERN"):
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", strings.TrimPrefix(errMsg, "INVALID_PATTERN: "))
+	case strings.Contains(errMsg, "OWNER_NOT_FOUND"):
+		respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "owner not found")
+	case strings.Contains(errMsg, "NOT_FOUND"):
+		respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
+	default:
+		h.log.Error().Err(err).Msg("failed to process ownership rules")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+	}
+}
 
-	prDetails, err := h.service.UpdatePRStatusToMerged(r.Context(), req.PullRequestID)
+func (h *Handler) SetUserActiveStatus(w http.ResponseWriter, r *http.Request) {
+	var req SetUserActiveRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	uid, err := uuid.Parse(req.UserID)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "PR not found")
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
+	reassign := req.ReassignReviews == nil || *req.ReassignReviews
+	userDetails, err := h.service.SetUserActiveStatus(r.Context(), uid, req.IsActive, reassign)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "user not found")
 			return
 		}
-		h.log.Error().Err(err).Msg("failed to merge pull request")
+		h.log.Error().Err(err).Msg("failed to set user active status")
 		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
 		return
 	}
 
-	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"pr": prDetails})
+	response := map[string]interface{}{"user": userDetails}
+	if !req.IsActive && reassign {
+		response["reassigned"] = userDetails.Reassigned
+		response["not_reassigned"] = userDetails.NotReassigned
+	}
+	if req.IsActive {
+		response["topped_up"] = userDetails.ToppedUp
+	}
+	respondWithJSON(w, h.log, http.StatusOK, response)
 }
 
-func (h *Handler) ReassignReviewer(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		PullRequestID string `json:"pull_request_id"`
-		OldUserID     string `json:"old_user_id"`
-	}
+func (h *Handler) SetUserSkills(w http.ResponseWriter, r *http.Request) {
+	var req SetUserSkillsRequest
 	if err := decodeJSON(w, r, &req); err != nil {
 		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
 		return
 	}
-
-	if strings.TrimSpace(req.PullRequestID) == "" {
-		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id is required")
+	uid, err := uuid.Parse(req.UserID)
+	if err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
 		return
 	}
-	if strings.TrimSpace(req.OldUserID) == "" {
-		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "old_user_id is required")
+	userDetails, err := h.service.SetUserSkills(r.Context(), uid, req.Skills)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "user not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to set user skills")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
 		return
 	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"user": userDetails})
+}
 
-	prDetails, err := h.service.ReassignReviewer(r.Context(), req.PullRequestID, req.OldUserID)
+func (h *Handler) SetUserMaxOpenReviews(w http.ResponseWriter, r *http.Request) {
+	var req SetUserMaxOpenReviewsRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	uid, err := uuid.Parse(req.UserID)
 	if err != nil {
-		errMsg := err.Error()
-		if strings.Contains(errMsg, "NOT_FOUND") {
-			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "PR or user not found")
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
+	userDetails, err := h.service.SetUserMaxOpenReviews(r.Context(), uid, req.MaxOpenReviews)
+	if err != nil {
+		if strings.Contains(err.Error(), "INVALID_MAX_OPEN_REVIEWS") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "max_open_reviews must be positive")
 			return
 		}
-		if strings.Contains(errMsg, "PR_MERGED") {
-			respondWithError(w, h.log, http.StatusConflict, "PR_MERGED", "cannot reassign on merged PR")
+		if errors.Is(err, pgx.ErrNoRows) {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "user not found")
 			return
 		}
-		if strings.Contains(errMsg, "NOT_ASSIGNED") {
-			respondWithError(w, h.log, http.StatusConflict, "NOT_ASSIGNED", "reviewer is not assigned to this PR")
+		h.log.Error().Err(err).Msg("failed to set user max open reviews")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"user": userDetails})
+}
+
+func (h *Handler) SetUserSeniority(w http.ResponseWriter, r *http.Request) {
+	var req SetUserSeniorityRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	uid, err := uuid.Parse(req.UserID)
+	if err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
+	userDetails, err := h.service.SetUserSeniority(r.Context(), uid, strings.ToLower(strings.TrimSpace(req.Seniority)))
+	if err != nil {
+		if strings.Contains(err.Error(), "INVALID_SENIORITY") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "seniority must be junior, middle or senior")
 			return
 		}
-		if strings.Contains(errMsg, "NO_CANDIDATE") {
-			respondWithError(w, h.log, http.StatusConflict, "NO_CANDIDATE", "no active replacement candidate in team")
+		if errors.Is(err, pgx.ErrNoRows) {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "user not found")
 			return
 		}
-		h.log.Error().Err(err).Msg("failed to reassign reviewer")
+		h.log.Error().Err(err).Msg("failed to set user seniority")
 		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
 		return
 	}
-
-	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{
-		"pr":          prDetails,
-		"replaced_by": prDetails.ReplacedBy,
-	})
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"user": userDetails})
 }
 
-// GetAssignmentStats возвращает статистику назначений (по пользователям и по PR)
-func (h *Handler) GetAssignmentStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := h.service.GetAssignmentStats(r.Context())
+func (h *Handler) SetPrimaryTeam(w http.ResponseWriter, r *http.Request) {
+	var req SetPrimaryTeamRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	uid, err := uuid.Parse(req.UserID)
+	if err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
+	req.TeamName = strings.TrimSpace(req.TeamName)
+	if req.TeamName == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "team_name cannot be empty")
+		return
+	}
+
+	userDetails, err := h.service.SetPrimaryTeam(r.Context(), uid, req.TeamName)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "TEAM_NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "user not found")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_TEAM_MEMBER") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "user is not a member of team_name")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to set primary team")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"user": userDetails})
+}
+
+func (h *Handler) AddAbsence(w http.ResponseWriter, r *http.Request) {
+	var req AddAbsenceRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	uid, err := uuid.Parse(req.UserID)
+	if err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
+	if req.StartsAt.IsZero() || req.EndsAt.IsZero() {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "starts_at and ends_at are required")
+		return
+	}
+
+	absence, err := h.service.AddAbsence(r.Context(), uid, req.StartsAt, req.EndsAt, strings.TrimSpace(req.Reason))
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "INVALID_PERIOD") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", strings.TrimPrefix(errMsg, "INVALID_PERIOD: "))
+			return
+		}
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "user not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to add absence")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusCreated, map[string]interface{}{"absence": absence})
+}
+
+func (h *Handler) GetAbsences(w http.ResponseWriter, r *http.Request) {
+	uidq := r.URL.Query().Get("user_id")
+	if uidq == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "user_id query missing")
+		return
+	}
+	uid, err := uuid.Parse(uidq)
+	if err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
+	absences, err := h.service.GetAbsences(r.Context(), uid)
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to get absences")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{
+		"user_id":  uidq,
+		"absences": absences,
+	})
+}
+
+func (h *Handler) DeleteAbsence(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AbsenceID string `json:"absence_id"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	absenceID, err := uuid.Parse(req.AbsenceID)
+	if err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid absence_id format")
+		return
+	}
+	if err := h.service.DeleteAbsence(r.Context(), absenceID); err != nil {
+		if strings.Contains(err.Error(), "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "absence not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to delete absence")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"absence_id": req.AbsenceID})
+}
+
+func (h *Handler) GetPRsForUser(w http.ResponseWriter, r *http.Request) {
+	uidq := r.URL.Query().Get("user_id")
+	if uidq == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "user_id query missing")
+		return
+	}
+	uid, err := uuid.Parse(uidq)
+	if err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
+	// pending=true - только PR, где от пользователя ещё ждут решения
+	pendingOnly := r.URL.Query().Get("pending") == "true"
+	prs, err := h.service.GetOpenPRsForReviewer(r.Context(), uid, pendingOnly)
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to get PRs for user")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{
+		"user_id":       uidq,
+		"pull_requests": prs,
+	})
+}
+
+func (h *Handler) CreatePullRequest(w http.ResponseWriter, r *http.Request) {
+	var req PullRequestRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+
+	if strings.TrimSpace(req.PullRequestID) == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id is required")
+		return
+	}
+	if strings.TrimSpace(req.PullRequestName) == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "pull_request_name is required")
+		return
+	}
+	if strings.TrimSpace(req.AuthorID) == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "author_id is required")
+		return
+	}
+
+	prDetails, err := h.service.CreatePullRequest(r.Context(), req.PullRequestID, req.PullRequestName, req.AuthorID, service.CreatePROptions{
+		ReviewersCount: req.ReviewersCount,
+		ChangedFiles:   req.ChangedFiles,
+		Repository:     strings.TrimSpace(req.Repository),
+		RequiredSkills: req.RequiredSkills,
+		TeamName:       strings.TrimSpace(req.TeamName),
+		Draft:          req.Draft,
+	})
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "INVALID_REVIEWERS_COUNT") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", strings.TrimPrefix(errMsg, "INVALID_REVIEWERS_COUNT: "))
+			return
+		}
+		if strings.Contains(errMsg, "TEAM_NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_TEAM_MEMBER") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "author is not a member of team_name")
+			return
+		}
+		if strings.Contains(errMsg, "PR_EXISTS") {
+			respondWithError(w, h.log, http.StatusConflict, "PR_EXISTS", "PR id already exists")
+			return
+		}
+		if strings.Contains(errMsg, "not found") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "author not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to create pull request")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+
+	if !h.includeRationale(w, r, prDetails) {
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusCreated, map[string]interface{}{"pr": prDetails})
+}
+
+// показывает, кого бы назначили при создании PR, ничего не создавая;
+// pull_request_id и pull_request_name не нужны
+func (h *Handler) PreviewPullRequest(w http.ResponseWriter, r *http.Request) {
+	var req PullRequestRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	if strings.TrimSpace(req.AuthorID) == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "author_id is required")
+		return
+	}
+
+	preview, err := h.service.PreviewAssignment(r.Context(), req.AuthorID, service.CreatePROptions{
+		ReviewersCount: req.ReviewersCount,
+		ChangedFiles:   req.ChangedFiles,
+		Repository:     strings.TrimSpace(req.Repository),
+		RequiredSkills: req.RequiredSkills,
+		TeamName:       strings.TrimSpace(req.TeamName),
+	})
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "INVALID_REVIEWERS_COUNT") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", strings.TrimPrefix(errMsg, "INVALID_REVIEWERS_COUNT: "))
+			return
+		}
+		if strings.Contains(errMsg, "invalid author_id") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid author_id format")
+			return
+		}
+		if strings.Contains(errMsg, "TEAM_NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "team not found")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_TEAM_MEMBER") {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "author is not a member of team_name")
+			return
+		}
+		if strings.Contains(errMsg, "not found") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "author not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to preview assignment")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"preview": preview})
+}
+
+func (h *Handler) MergePullRequest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+		// слить в обход политики слияния команды; отмечается в PR
+		Force bool `json:"force,omitempty"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+
+	if strings.TrimSpace(req.PullRequestID) == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id is required")
+		return
+	}
+
+	prDetails, err := h.service.UpdatePRStatusToMerged(r.Context(), req.PullRequestID, req.Force)
+	if err != nil {
+		if strings.Contains(err.Error(), "FORBIDDEN") {
+			respondWithError(w, h.log, http.StatusForbidden, "FORBIDDEN", strings.TrimPrefix(err.Error(), "FORBIDDEN: "))
+			return
+		}
+		if strings.Contains(err.Error(), "MERGE_BLOCKED") {
+			respondWithError(w, h.log, http.StatusConflict, "MERGE_BLOCKED", strings.TrimPrefix(err.Error(), "MERGE_BLOCKED: "))
+			return
+		}
+		if strings.Contains(err.Error(), "INVALID_TRANSITION") {
+			respondWithError(w, h.log, http.StatusConflict, "INVALID_TRANSITION", strings.TrimPrefix(err.Error(), "INVALID_TRANSITION: "))
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "PR not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to merge pull request")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+
+	if !h.includeRationale(w, r, prDetails) {
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"pr": prDetails})
+}
+
+func (h *Handler) ReassignReviewer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+		OldUserID     string `json:"old_user_id"`
+		// необязательно: кого назначить вместо old_user_id
+		NewUserID string `json:"new_user_id,omitempty"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+
+	if strings.TrimSpace(req.PullRequestID) == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id is required")
+		return
+	}
+	if strings.TrimSpace(req.OldUserID) == "" {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "old_user_id is required")
+		return
+	}
+	req.NewUserID = strings.TrimSpace(req.NewUserID)
+	if req.NewUserID != "" {
+		if _, err := uuid.Parse(req.NewUserID); err != nil {
+			respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid new_user_id format")
+			return
+		}
+	}
+
+	prDetails, err := h.service.ReassignReviewer(r.Context(), req.PullRequestID, req.OldUserID, req.NewUserID)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "PR or user not found")
+			return
+		}
+		if strings.Contains(errMsg, "PR_MERGED") {
+			respondWithError(w, h.log, http.StatusConflict, "PR_MERGED", "cannot reassign on merged PR")
+			return
+		}
+		if strings.Contains(errMsg, "PR_CLOSED") {
+			respondWithError(w, h.log, http.StatusConflict, "PR_CLOSED", "cannot reassign on closed PR")
+			return
+		}
+		if strings.Contains(errMsg, "PR_DRAFT") {
+			respondWithError(w, h.log, http.StatusConflict, "PR_DRAFT", "draft PR has no reviewers")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_ASSIGNED") {
+			respondWithError(w, h.log, http.StatusConflict, "NOT_ASSIGNED", "reviewer is not assigned to this PR")
+			return
+		}
+		if strings.Contains(errMsg, "NO_CANDIDATE") {
+			respondWithError(w, h.log, http.StatusConflict, "NO_CANDIDATE", "no active replacement candidate in team")
+			return
+		}
+		if strings.Contains(errMsg, "INVALID_REVIEWER") {
+			respondWithError(w, h.log, http.StatusConflict, "INVALID_REVIEWER", strings.TrimPrefix(errMsg, "INVALID_REVIEWER: "))
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to reassign reviewer")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+
+	if !h.includeRationale(w, r, prDetails) {
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{
+		"pr":          prDetails,
+		"replaced_by": prDetails.ReplacedBy,
+	})
+}
+
+// MarkPullRequestReady переводит черновик в OPEN и назначает ревьюверов
+func (h *Handler) MarkPullRequestReady(w http.ResponseWriter, r *http.Request) {
+	var req ReadyPullRequestRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	h.changeStatus(w, r, req.PullRequestID, func(ctx context.Context, prID string) (*service.PRDetails, error) {
+		return h.service.MarkPullRequestReady(ctx, prID, service.CreatePROptions{
+			ChangedFiles: req.ChangedFiles,
+			Repository:   strings.TrimSpace(req.Repository),
+		})
+	})
+}
+
+func (h *Handler) ClosePullRequest(w http.ResponseWriter, r *http.Request) {
+	h.changeStatusByID(w, r, h.service.ClosePullRequest)
+}
+
+func (h *Handler) ReopenPullRequest(w http.ResponseWriter, r *http.Request) {
+	h.changeStatusByID(w, r, h.service.ReopenPullRequest)
+}
+
+// разбирает запрос из одного pull_request_id и меняет состояние PR
+func (h *Handler) changeStatusByID(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, prID string) (*service.PRDetails, error)) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	h.changeStatus(w, r, req.PullRequestID, change)
+}
+
+// общая обработка переходов между состояниями PR: ready/close/reopen
+func (h *Handler) changeStatus(w http.ResponseWriter, r *http.Request, prID string, change func(ctx context.Context, prID string) (*service.PRDetails, error)) {
+	if _, err := uuid.Parse(prID); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid pull_request_id format")
+		return
+	}
+
+	prDetails, err := change(r.Context(), prID)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "INVALID_TRANSITION") {
+			respondWithError(w, h.log, http.StatusConflict, "INVALID_TRANSITION", strings.TrimPrefix(errMsg, "INVALID_TRANSITION: "))
+			return
+		}
+		if strings.Contains(errMsg, "NOT_TEAM_MEMBER") {
+			respondWithError(w, h.log, http.StatusConflict, "NOT_TEAM_MEMBER", "author is no longer a member of the PR team")
+			return
+		}
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "PR not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to change PR status")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+
+	if !h.includeRationale(w, r, prDetails) {
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"pr": prDetails})
+}
+
+// структура запроса для решения ревьювера
+type ReviewRequest struct {
+	PullRequestID string `json:"pull_request_id"`
+	UserID        string `json:"user_id"`
+	// APPROVED, CHANGES_REQUESTED или COMMENTED
+	Verdict string `json:"verdict"`
+}
+
+// SubmitReview сохраняет решение назначенного ревьювера по PR
+func (h *Handler) SubmitReview(w http.ResponseWriter, r *http.Request) {
+	var req ReviewRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	if _, err := uuid.Parse(req.PullRequestID); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid pull_request_id format")
+		return
+	}
+	if _, err := uuid.Parse(req.UserID); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
+	req.Verdict = strings.ToUpper(strings.TrimSpace(req.Verdict))
+	if !service.IsValidVerdict(req.Verdict) {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "verdict must be APPROVED, CHANGES_REQUESTED or COMMENTED")
+		return
+	}
+
+	prDetails, err := h.service.SubmitReview(r.Context(), req.PullRequestID, req.UserID, req.Verdict)
+	if err != nil {
+		errMsg := err.Error()
+		for _, code := range []string{"PR_MERGED", "PR_CLOSED", "PR_DRAFT", "NOT_ASSIGNED"} {
+			if strings.Contains(errMsg, code) {
+				respondWithError(w, h.log, http.StatusConflict, code, strings.TrimPrefix(errMsg, code+": "))
+				return
+			}
+		}
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "PR not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to submit review")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"pr": prDetails})
+}
+
+// GetUnderstaffedPRs возвращает OPEN PR, которым не хватает ревьюверов до целевого числа
+func (h *Handler) GetUnderstaffedPRs(w http.ResponseWriter, r *http.Request) {
+	prs, err := h.service.GetUnderstaffedPRs(r.Context())
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to get understaffed pull requests")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"pull_requests": prs})
+}
+
+// структура запроса для ручного добавления или снятия ревьювера
+type PRReviewerRequest struct {
+	PullRequestID string `json:"pull_request_id"`
+	UserID        string `json:"user_id"`
+}
+
+func (h *Handler) AddReviewer(w http.ResponseWriter, r *http.Request) {
+	h.changeReviewer(w, r, h.service.AddReviewer)
+}
+
+func (h *Handler) RemoveReviewer(w http.ResponseWriter, r *http.Request) {
+	h.changeReviewer(w, r, h.service.RemoveReviewer)
+}
+
+// общая обработка addReviewer/removeReviewer: разбор запроса и ошибок правил
+func (h *Handler) changeReviewer(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, prID, userID string) (*service.PRDetails, error)) {
+	var req PRReviewerRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid request format")
+		return
+	}
+	if _, err := uuid.Parse(req.PullRequestID); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid pull_request_id format")
+		return
+	}
+	if _, err := uuid.Parse(req.UserID); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid user_id format")
+		return
+	}
+
+	prDetails, err := change(r.Context(), req.PullRequestID, req.UserID)
+	if err != nil {
+		errMsg := err.Error()
+		for _, code := range []string{"PR_MERGED", "PR_CLOSED", "PR_DRAFT", "SELF_REVIEW", "USER_INACTIVE", "ALREADY_ASSIGNED", "NOT_ASSIGNED", "TOO_MANY_REVIEWERS"} {
+			if strings.Contains(errMsg, code) {
+				respondWithError(w, h.log, http.StatusConflict, code, strings.TrimPrefix(errMsg, code+": "))
+				return
+			}
+		}
+		if strings.Contains(errMsg, "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "PR or user not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to change PR reviewers")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+
+	if !h.includeRationale(w, r, prDetails) {
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"pr": prDetails})
+}
+
+// GetPullRequest возвращает PR с текущими ревьюверами
+func (h *Handler) GetPullRequest(w http.ResponseWriter, r *http.Request) {
+	prID := r.URL.Query().Get("pull_request_id")
+	if _, err := uuid.Parse(prID); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid pull_request_id format")
+		return
+	}
+
+	prDetails, err := h.service.GetPullRequest(r.Context(), prID)
+	if err != nil {
+		if strings.Contains(err.Error(), "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "PR not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to get pull request")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+
+	if !h.includeRationale(w, r, prDetails) {
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"pr": prDetails})
+}
+
+// GetPRTimeline возвращает ленту событий PR: создание, назначения, переназначения,
+// смены статуса и слияние, с тем, кто их выполнил
+func (h *Handler) GetPRTimeline(w http.ResponseWriter, r *http.Request) {
+	prID := r.URL.Query().Get("pull_request_id")
+	if _, err := uuid.Parse(prID); err != nil {
+		respondWithError(w, h.log, http.StatusBadRequest, "BAD_REQUEST", "invalid pull_request_id format")
+		return
+	}
+
+	events, err := h.service.GetPRTimeline(r.Context(), prID)
+	if err != nil {
+		if strings.Contains(err.Error(), "NOT_FOUND") {
+			respondWithError(w, h.log, http.StatusNotFound, "NOT_FOUND", "PR not found")
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to get pull request timeline")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{
+		"pull_request_id": prID,
+		"events":          events,
+	})
+}
+
+// по include=rationale добавляет в ответ историю назначений PR: кто, как и почему был
+// назначен, включая уже снятых ревьюверов. false - ошибка уже отправлена клиенту
+func (h *Handler) includeRationale(w http.ResponseWriter, r *http.Request, pr *service.PRDetails) bool {
+	if !slices.Contains(strings.Split(r.URL.Query().Get("include"), ","), "rationale") {
+		return true
+	}
+	rationale, err := h.service.GetAssignmentRationale(r.Context(), pr.PullRequestID)
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to get assignment rationale")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return false
+	}
+	pr.Rationale = rationale
+	return true
+}
+
+// GetAssignmentStats возвращает статистику назначений (по пользователям и по PR)
+func (h *Handler) GetAssignmentStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.GetAssignmentStats(r.Context())
 	if err != nil {
 		h.log.Error().Err(err).Msg("failed to get assignment stats")
 		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
@@ -318,3 +1303,14 @@ func (h *Handler) GetAssignmentStats(w http.ResponseWriter, r *http.Request) {
 	}
 	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"stats": stats})
 }
+
+// GetPairStats возвращает матрицу пар автор -> ревьювер по командам за окно истории
+func (h *Handler) GetPairStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.GetPairStats(r.Context())
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to get pair stats")
+		respondWithError(w, h.log, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	respondWithJSON(w, h.log, http.StatusOK, map[string]interface{}{"stats": stats})
+}
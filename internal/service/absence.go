@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// запланированное отсутствие пользователя
+type Absence struct {
+	AbsenceID string `json:"absence_id"`
+	UserID    string `json:"user_id"`
+	StartsAt  string `json:"starts_at"`
+	EndsAt    string `json:"ends_at"`
+	Reason    string `json:"reason"`
+}
+
+// добавляет отсутствие; в его время пользователь не считается кандидатом в ревьюверы
+func (s *Service) AddAbsence(ctx context.Context, userID uuid.UUID, startsAt, endsAt time.Time, reason string) (*Absence, error) {
+	if startsAt.IsZero() || endsAt.IsZero() {
+		return nil, fmt.Errorf("INVALID_PERIOD: starts_at and ends_at are required")
+	}
+	if !endsAt.After(startsAt) {
+		return nil, fmt.Errorf("INVALID_PERIOD: ends_at must be after starts_at")
+	}
+	if !endsAt.After(time.Now()) {
+		return nil, fmt.Errorf("INVALID_PERIOD: ends_at must be in the future")
+	}
+	if _, err := s.store.GetUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("NOT_FOUND: user not found")
+	}
+
+	a, err := s.store.CreateAbsence(ctx, db.CreateAbsenceParams{
+		UserID:   userID,
+		StartsAt: pgtype.Timestamptz{Time: startsAt, Valid: true},
+		EndsAt:   pgtype.Timestamptz{Time: endsAt, Valid: true},
+		Reason:   reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return absenceFromDB(a), nil
+}
+
+// получает все отсутствия пользователя
+func (s *Service) GetAbsences(ctx context.Context, userID uuid.UUID) ([]Absence, error) {
+	absences, err := s.store.GetAbsencesForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Absence, len(absences))
+	for i, a := range absences {
+		result[i] = *absenceFromDB(a)
+	}
+	return result, nil
+}
+
+// удаляет отсутствие
+func (s *Service) DeleteAbsence(ctx context.Context, absenceID uuid.UUID) error {
+	n, err := s.store.DeleteAbsence(ctx, absenceID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("NOT_FOUND: absence not found")
+	}
+	return nil
+}
+
+// переназначает OPEN ревью пользователей, чьё отсутствие началось с прошлого запуска.
+// Вызывается периодически фоновой задачей; возвращает выполненные и невыполненные замены.
+func (s *Service) ProcessStartedAbsences(ctx context.Context) ([]Reassignment, []Reassignment, error) {
+	ctx = systemActor(ctx)
+	var reassigned, notReassigned []Reassignment
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		started, err := txq.ClaimStartedAbsences(ctx)
+		if err != nil {
+			return err
+		}
+
+		// группируем по командам, чтобы заменять одним набором запросов на команду
+		byTeam := make(map[uuid.UUID][]uuid.UUID)
+		var teamOrder []uuid.UUID
+		for _, a := range uniqueAbsentUsers(started) {
+			user, err := txq.GetUser(ctx, a)
+			if err != nil {
+				return err
+			}
+			teamID := uuid.Nil
+			if user.TeamID.Valid {
+				teamID = user.TeamID.Bytes
+			}
+			if _, ok := byTeam[teamID]; !ok {
+				teamOrder = append(teamOrder, teamID)
+			}
+			byTeam[teamID] = append(byTeam[teamID], user.ID)
+		}
+
+		for _, teamID := range teamOrder {
+			var team db.Team
+			if teamID != uuid.Nil {
+				if team, err = txq.GetTeam(ctx, teamID); err != nil {
+					return err
+				}
+			}
+			done, notDone, err := s.replaceReviewers(ctx, txq, team, byTeam[teamID])
+			if err != nil {
+				return err
+			}
+			reassigned = append(reassigned, done...)
+			notReassigned = append(notReassigned, notDone...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return reassigned, notReassigned, nil
+}
+
+// добирает ревьюверов на OPEN PR команд пользователей, чьё отсутствие закончилось с прошлого
+// запуска. Вызывается той же фоновой задачей; возвращает сделанные добавления.
+func (s *Service) ProcessEndedAbsences(ctx context.Context) ([]TopUp, error) {
+	ctx = systemActor(ctx)
+	var result []TopUp
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		ended, err := txq.ClaimEndedAbsences(ctx)
+		if err != nil || len(ended) == 0 {
+			return err
+		}
+		teamIDs, err := usersTeams(ctx, txq, uniqueAbsentUsers(ended))
+		if err != nil || len(teamIDs) == 0 {
+			return err
+		}
+		result, err = s.topUpUnderstaffed(ctx, txq, topUpScope{teamIDs: teamIDs})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func uniqueAbsentUsers(absences []db.UserAbsence) []uuid.UUID {
+	ids := make([]uuid.UUID, len(absences))
+	for i, a := range absences {
+		ids[i] = a.UserID
+	}
+	return uniqueIDs(ids)
+}
+
+func absenceFromDB(a db.UserAbsence) *Absence {
+	return &Absence{
+		AbsenceID: a.ID.String(),
+		UserID:    a.UserID.String(),
+		StartsAt:  a.StartsAt.Time.Format(time.RFC3339),
+		EndsAt:    a.EndsAt.Time.Format(time.RFC3339),
+		Reason:    a.Reason,
+	}
+}
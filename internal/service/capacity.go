@@ -0,0 +1,66 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// задаёт лимит одновременно открытых ревью пользователя; nil - действует лимит команды
+func (s *Service) SetUserMaxOpenReviews(ctx context.Context, userID uuid.UUID, limit *int) (*UserDetails, error) {
+	param := pgtype.Int4{}
+	if limit != nil {
+		if *limit <= 0 {
+			return nil, fmt.Errorf("INVALID_MAX_OPEN_REVIEWS: max_open_reviews must be positive")
+		}
+		param = pgtype.Int4{Int32: int32(*limit), Valid: true}
+	}
+
+	user, err := s.store.SetUserMaxOpenReviews(ctx, db.SetUserMaxOpenReviewsParams{ID: userID, MaxOpenReviews: param})
+	if err != nil {
+		return nil, err
+	}
+
+	details := &UserDetails{User: user}
+	if user.TeamID.Valid {
+		if team, err := s.store.GetTeam(ctx, user.TeamID.Bytes); err == nil {
+			details.TeamName = team.Name
+		}
+	}
+	return details, nil
+}
+
+// достиг ли кандидат своего лимита открытых ревью
+func (c Candidate) atCapacity() bool {
+	return c.MaxOpenReviews.Valid && c.OpenReviews >= int64(c.MaxOpenReviews.Int32)
+}
+
+// проверяет, остался ли PR без части ревьюверов из-за лимитов: есть ли в команде автора
+// или её резервных командах (включая соседей по дереву) свободные по остальным правилам, но загруженные до предела люди
+func (s *Service) capacityLimited(ctx context.Context, q *db.Queries, teamID uuid.UUID, exclude map[uuid.UUID]bool) (bool, error) {
+	fallbacks, err := s.reserveTeams(ctx, q, teamID)
+	if err != nil {
+		return false, err
+	}
+	teamIDs := []uuid.UUID{teamID}
+	for _, fb := range fallbacks {
+		teamIDs = append(teamIDs, fb.ID)
+	}
+
+	excludeIDs := make([]uuid.UUID, 0, len(exclude))
+	for id := range exclude {
+		excludeIDs = append(excludeIDs, id)
+	}
+	slices.SortFunc(excludeIDs, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+
+	n, err := q.CountCandidatesAtCapacity(ctx, db.CountCandidatesAtCapacityParams{TeamIds: teamIDs, ExcludeIds: excludeIDs})
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
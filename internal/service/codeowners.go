@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// правило владения: файлы, подходящие под pattern, принадлежат owners
+type OwnershipRule struct {
+	Pattern string   `json:"pattern"`
+	Owners  []string `json:"owners"`
+}
+
+// набор правил команды или репозитория (задаётся ровно одно из двух)
+type OwnershipRuleset struct {
+	TeamName   string          `json:"team_name,omitempty"`
+	Repository string          `json:"repository,omitempty"`
+	Rules      []OwnershipRule `json:"rules"`
+}
+
+// получает набор правил команды или репозитория
+func (s *Service) GetOwnershipRules(ctx context.Context, teamName, repository string) (*OwnershipRuleset, error) {
+	var result *OwnershipRuleset
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		scope, err := ownershipScope(ctx, txq, teamName, repository)
+		if err != nil {
+			return err
+		}
+		rules, err := txq.GetOwnershipRules(ctx, db.GetOwnershipRulesParams{TeamID: scope.TeamID, Repository: scope.Repository})
+		if err != nil {
+			return err
+		}
+		result = rulesetFromDB(teamName, repository, rules)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// заменяет набор правил команды или репозитория целиком
+func (s *Service) SetOwnershipRules(ctx context.Context, ruleset OwnershipRuleset) (*OwnershipRuleset, error) {
+	for _, rule := range ruleset.Rules {
+		if _, err := compileOwnershipPattern(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("INVALID_PATTERN: %w", err)
+		}
+	}
+
+	var result *OwnershipRuleset
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		scope, err := ownershipScope(ctx, txq, ruleset.TeamName, ruleset.Repository)
+		if err != nil {
+			return err
+		}
+		if err := txq.DeleteOwnershipRules(ctx, db.DeleteOwnershipRulesParams{TeamID: scope.TeamID, Repository: scope.Repository}); err != nil {
+			return err
+		}
+
+		for i, rule := range ruleset.Rules {
+			owners := make([]uuid.UUID, 0, len(rule.Owners))
+			for _, o := range rule.Owners {
+				ownerID, err := uuid.Parse(o)
+				if err != nil {
+					return fmt.Errorf("OWNER_NOT_FOUND: invalid owner id %s", o)
+				}
+				if _, err := txq.GetUser(ctx, ownerID); err != nil {
+					return fmt.Errorf("OWNER_NOT_FOUND: owner %s not found", o)
+				}
+				owners = append(owners, ownerID)
+			}
+			if err := txq.AddOwnershipRule(ctx, db.AddOwnershipRuleParams{
+				TeamID:     scope.TeamID,
+				Repository: scope.Repository,
+				Position:   int32(i),
+				Pattern:    rule.Pattern,
+				OwnerIds:   owners,
+			}); err != nil {
+				return err
+			}
+		}
+
+		rules, err := txq.GetOwnershipRules(ctx, db.GetOwnershipRulesParams{TeamID: scope.TeamID, Repository: scope.Repository})
+		if err != nil {
+			return err
+		}
+		result = rulesetFromDB(ruleset.TeamName, ruleset.Repository, rules)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// определяет, чей набор правил имеется в виду: команды или репозитория
+func ownershipScope(ctx context.Context, q *db.Queries, teamName, repository string) (db.GetOwnershipRulesParams, error) {
+	if (teamName == "") == (repository == "") {
+		return db.GetOwnershipRulesParams{}, fmt.Errorf("INVALID_SCOPE: exactly one of team_name and repository is required")
+	}
+	if repository != "" {
+		return db.GetOwnershipRulesParams{Repository: pgtype.Text{String: repository, Valid: true}}, nil
+	}
+	team, err := q.GetTeamByName(ctx, teamName)
+	if err != nil {
+		return db.GetOwnershipRulesParams{}, fmt.Errorf("NOT_FOUND: team not found")
+	}
+	return db.GetOwnershipRulesParams{TeamID: pgtype.UUID{Bytes: team.ID, Valid: true}}, nil
+}
+
+func rulesetFromDB(teamName, repository string, rules []db.OwnershipRule) *OwnershipRuleset {
+	result := &OwnershipRuleset{
+		TeamName:   teamName,
+		Repository: repository,
+		Rules:      make([]OwnershipRule, len(rules)),
+	}
+	for i, r := range rules {
+		owners := make([]string, len(r.OwnerIds))
+		for j, id := range r.OwnerIds {
+			owners[j] = id.String()
+		}
+		result.Rules[i] = OwnershipRule{Pattern: r.Pattern, Owners: owners}
+	}
+	return result
+}
+
+// правила для PR: набор репозитория, если он задан и не пуст, иначе набор команды автора
+func ownershipRulesFor(ctx context.Context, q *db.Queries, repository string, teamID pgtype.UUID) ([]db.OwnershipRule, error) {
+	if repository != "" {
+		rules, err := q.GetOwnershipRules(ctx, db.GetOwnershipRulesParams{Repository: pgtype.Text{String: repository, Valid: true}})
+		if err != nil || len(rules) > 0 {
+			return rules, err
+		}
+	}
+	if !teamID.Valid {
+		return nil, nil
+	}
+	return q.GetOwnershipRules(ctx, db.GetOwnershipRulesParams{TeamID: teamID})
+}
+
+// владельцы изменённых файлов; для каждого файла действует последнее подходящее правило.
+// Порядок - по числу принадлежащих владельцу файлов, затем по первому появлению.
+func ownersOfFiles(rules []db.OwnershipRule, files []string) []uuid.UUID {
+	compiled := make([]*regexp.Regexp, len(rules))
+	for i, r := range rules {
+		// правила проверяются при сохранении, битые просто пропускаем
+		compiled[i], _ = compileOwnershipPattern(r.Pattern)
+	}
+
+	owned := make(map[uuid.UUID]int)
+	var order []uuid.UUID
+	for _, file := range files {
+		file = strings.TrimPrefix(strings.TrimSpace(file), "/")
+		for i := len(rules) - 1; i >= 0; i-- {
+			if compiled[i] == nil || !compiled[i].MatchString(file) {
+				continue
+			}
+			for _, id := range rules[i].OwnerIds {
+				if _, ok := owned[id]; !ok {
+					order = append(order, id)
+				}
+				owned[id]++
+			}
+			break
+		}
+	}
+
+	slices.SortStableFunc(order, func(a, b uuid.UUID) int {
+		return owned[b] - owned[a]
+	})
+	return order
+}
+
+// переводит шаблон CODEOWNERS в регулярное выражение:
+//   - "/path" привязан к корню, как и любой шаблон со слешем в середине;
+//     шаблон без слешей совпадает на любой глубине;
+//   - "*" - любая часть одного сегмента, "?" - один символ, "**" - любое число сегментов;
+//   - шаблон совпадает и с самим путём, и со всем, что лежит под ним;
+//     завершающий "/" означает только содержимое каталога, а "dir/*" - только его файлы.
+func compileOwnershipPattern(pattern string) (*regexp.Regexp, error) {
+	p := strings.TrimSpace(pattern)
+	if p == "" || strings.HasPrefix(p, "!") {
+		return nil, fmt.Errorf("unsupported pattern %q", pattern)
+	}
+
+	dirOnly := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("unsupported pattern %q", pattern)
+	}
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+		case p[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	switch {
+	case dirOnly:
+		b.WriteString("/.*$")
+	case strings.HasSuffix(p, "/*"):
+		// "docs/*" - только файлы прямо в docs, без вложенных каталогов
+		b.WriteString("$")
+	default:
+		b.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(b.String())
+}
+
+// доступные владельцы в порядке ранга ownerIDs; недоступных запрос уже отбросил
+func rankedOwners(ownerIDs []uuid.UUID, rows []db.GetActiveCandidatesByIDsRow) []Candidate {
+	byID := make(map[uuid.UUID]db.GetActiveCandidatesByIDsRow, len(rows))
+	for _, r := range rows {
+		byID[r.ID] = r
+	}
+	owners := make([]Candidate, 0, len(rows))
+	for _, id := range ownerIDs {
+		if r, ok := byID[id]; ok {
+			owners = append(owners, ownerCandidate(r))
+		}
+	}
+	return owners
+}
+
+func ownerCandidate(r db.GetActiveCandidatesByIDsRow) Candidate {
+	return Candidate{
+		User:           db.User{ID: r.ID, Name: r.Name, IsActive: r.IsActive, TeamID: r.TeamID, Skills: r.Skills, Seniority: r.Seniority},
+		OpenReviews:    r.OpenReviews,
+		LastAssignedAt: r.LastAssignedAt,
+		MaxOpenReviews: r.MaxOpenReviews,
+	}
+}
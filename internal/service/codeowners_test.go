@@ -0,0 +1,127 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+)
+
+func TestCompileOwnershipPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{
+			pattern: "*.go",
+			match:   []string{"main.go", "internal/service/service.go"},
+			noMatch: []string{"main.gox", "README.md"},
+		},
+		{
+			pattern: "/docs",
+			match:   []string{"docs", "docs/tz/openapi.yml"},
+			noMatch: []string{"api/docs/index.md", "docsite/index.md"},
+		},
+		{
+			pattern: "migrations",
+			match:   []string{"migrations/0001_initial_schema.up.sql", "loadtest/migrations/x.sql"},
+			noMatch: []string{"migrations.md"},
+		},
+		{
+			pattern: "internal/db/",
+			match:   []string{"internal/db/models.go", "internal/db/sub/x.go"},
+			noMatch: []string{"internal/db", "internal/dbx/models.go"},
+		},
+		{
+			pattern: "docs/*",
+			match:   []string{"docs/README.md"},
+			noMatch: []string{"docs/tz/openapi.yml"},
+		},
+		{
+			pattern: "internal/**/query.sql.go",
+			match:   []string{"internal/query.sql.go", "internal/db/query.sql.go", "internal/a/b/query.sql.go"},
+			noMatch: []string{"cmd/query.sql.go"},
+		},
+		{
+			pattern: "cmd/**",
+			match:   []string{"cmd/server/main.go"},
+			noMatch: []string{"internal/cmd/main.go"},
+		},
+		{
+			pattern: "v?.sql",
+			match:   []string{"v1.sql", "sql/v2.sql"},
+			noMatch: []string{"v10.sql", "v/.sql"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			re, err := compileOwnershipPattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("compileOwnershipPattern(%q): %v", tt.pattern, err)
+			}
+			for _, path := range tt.match {
+				if !re.MatchString(path) {
+					t.Errorf("%q should match %q", tt.pattern, path)
+				}
+			}
+			for _, path := range tt.noMatch {
+				if re.MatchString(path) {
+					t.Errorf("%q should not match %q", tt.pattern, path)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileOwnershipPatternUnsupported(t *testing.T) {
+	for _, pattern := range []string{"", "  ", "!*.go", "/"} {
+		if _, err := compileOwnershipPattern(pattern); err == nil {
+			t.Errorf("compileOwnershipPattern(%q): expected error", pattern)
+		}
+	}
+}
+
+func TestOwnersOfFiles(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	rules := []db.OwnershipRule{
+		{Pattern: "*", OwnerIds: []uuid.UUID{carol}},
+		{Pattern: "*.go", OwnerIds: []uuid.UUID{alice}},
+		{Pattern: "/internal/db/", OwnerIds: []uuid.UUID{bob}},
+		{Pattern: "!broken", OwnerIds: []uuid.UUID{carol}},
+	}
+	tests := []struct {
+		name  string
+		files []string
+		want  []uuid.UUID
+	}{
+		{
+			name:  "last matching rule wins",
+			files: []string{"internal/db/models.go"},
+			want:  []uuid.UUID{bob},
+		},
+		{
+			name:  "ranked by owned files",
+			files: []string{"README.md", "cmd/server/main.go", "internal/service/service.go"},
+			want:  []uuid.UUID{alice, carol},
+		},
+		{
+			name:  "ties keep first appearance",
+			files: []string{"/internal/db/query.sql.go", " main.go "},
+			want:  []uuid.UUID{bob, alice},
+		},
+		{
+			name:  "no files",
+			files: nil,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ownersOfFiles(rules, tt.files); !slices.Equal(got, tt.want) {
+				t.Errorf("ownersOfFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// снятое с PR назначение и его замена (пустая, если замены не нашлось)
+type Reassignment struct {
+	PullRequestID string `json:"pull_request_id"`
+	OldUserID     string `json:"old_user_id"`
+	NewUserID     string `json:"new_user_id,omitempty"`
+	// замена взята из резервной команды
+	FromFallback bool `json:"from_fallback,omitempty"`
+	// правила состава команды PR, которые не удалось выполнить
+	RelaxedRules []string `json:"relaxed_rules,omitempty"`
+}
+
+// результат массовой деактивации команды
+type DeactivationResult struct {
+	TeamName         string   `json:"team_name"`
+	DeactivatedUsers []string `json:"deactivated_users"`
+	// участники, которые состоят и в других командах: они остаются активными и на своих ревью
+	KeptActive    []string       `json:"kept_active,omitempty"`
+	Reassigned    []Reassignment `json:"reassigned"`
+	NotReassigned []Reassignment `json:"not_reassigned"`
+}
+
+// деактивирует всю команду или выбранных участников и переназначает их OPEN ревью.
+// Участники, состоящие и в других командах, не деактивируются.
+// Всё выполняется в одной транзакции; если выбранный пользователь не состоит в команде,
+// ничего не меняется.
+func (s *Service) DeactivateTeam(ctx context.Context, teamName string, userIDs []uuid.UUID) (*DeactivationResult, error) {
+	team, err := s.store.GetTeamByName(ctx, teamName)
+	if err != nil {
+		return nil, fmt.Errorf("NOT_FOUND: team not found")
+	}
+
+	userIDs = uniqueIDs(userIDs)
+	result := &DeactivationResult{TeamName: team.Name}
+
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		members, err := txq.DeactivateUsersByTeam(ctx, db.DeactivateUsersByTeamParams{
+			TeamID:  team.ID,
+			UserIds: userIDs,
+		})
+		if err != nil {
+			return err
+		}
+		if len(members) < len(userIDs) {
+			return fmt.Errorf("NOT_IN_TEAM: some users are not members of team %s", team.Name)
+		}
+
+		result.DeactivatedUsers = make([]string, 0, len(members))
+		deactivated := make([]uuid.UUID, 0, len(members))
+		for _, m := range members {
+			if !m.Deactivated {
+				result.KeptActive = append(result.KeptActive, m.UserID.String())
+				continue
+			}
+			deactivated = append(deactivated, m.UserID)
+			result.DeactivatedUsers = append(result.DeactivatedUsers, m.UserID.String())
+		}
+
+		result.Reassigned, result.NotReassigned, err = s.replaceReviewers(ctx, txq, team, deactivated)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// снимает пользователей со всех OPEN PR и подбирает каждому замену из активных участников
+// команды, через которую он был назначен (назначенным не через команду - из team), а если там
+// никого не осталось - из её резервных команд и соседей по дереву команд.
+// Число запросов не зависит от количества PR: снятие, чтение PR, чтение кандидатов (по разу на
+// каждую понадобившуюся команду) и массовые вставки назначений и их истории; распределение
+// делает стратегия команды с учётом уже сделанных назначений, затем замена доводится до
+// правил состава команды PR (невыполненные попадают в relaxed_rules).
+func (s *Service) replaceReviewers(ctx context.Context, q *db.Queries, team db.Team, userIDs []uuid.UUID) ([]Reassignment, []Reassignment, error) {
+	reassigned := make([]Reassignment, 0)
+	notReassigned := make([]Reassignment, 0)
+
+	removed, err := q.RemoveReviewersFromOpenPRs(ctx, userIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(removed) == 0 {
+		return reassigned, notReassigned, nil
+	}
+	closed := db.CloseAssignmentsParams{}
+	for _, r := range removed {
+		closed.PrIds = append(closed.PrIds, r.PrID)
+		closed.UserIds = append(closed.UserIds, r.UserID)
+	}
+	if err := q.CloseAssignments(ctx, closed); err != nil {
+		return nil, nil, err
+	}
+	slices.SortFunc(removed, func(a, b db.RemoveReviewersFromOpenPRsRow) int {
+		if c := bytes.Compare(a.PrID[:], b.PrID[:]); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.UserID[:], b.UserID[:])
+	})
+
+	prIDs := make([]uuid.UUID, 0, len(removed))
+	for _, r := range removed {
+		prIDs = append(prIDs, r.PrID)
+	}
+	prIDs = uniqueIDs(prIDs)
+	if err := q.TouchPullRequests(ctx, prIDs); err != nil {
+		return nil, nil, err
+	}
+	prs, err := q.GetPullRequestsWithReviewers(ctx, prIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// на каждом PR нельзя назначить автора и тех, кто уже ревьювит
+	busy := make(map[uuid.UUID]map[uuid.UUID]bool, len(prs))
+	// оставшиеся ревьюверы и правила состава команды PR
+	current := make(map[uuid.UUID][]Candidate, len(prs))
+	rules := make(map[uuid.UUID]seniorityRules, len(prs))
+	requiredSkills := make(map[uuid.UUID][]string, len(prs))
+	authorOf := make(map[uuid.UUID]uuid.UUID, len(prs))
+	authorIDs := make([]uuid.UUID, 0, len(prs))
+	for _, pr := range prs {
+		requiredSkills[pr.ID] = pr.RequiredSkills
+		authorOf[pr.ID] = pr.AuthorID
+		authorIDs = append(authorIDs, pr.AuthorID)
+		taken := map[uuid.UUID]bool{pr.AuthorID: true}
+		for _, id := range pr.ReviewerIds {
+			taken[id] = true
+		}
+		busy[pr.ID] = taken
+		current[pr.ID] = reviewerCandidates(pr.ReviewerIds, pr.ReviewerSeniorities)
+		rules[pr.ID] = seniorityRules{requireSenior: pr.RequireSenior, juniorsNotAlone: pr.JuniorsNotAlone}
+	}
+	pairings, err := s.recentPairings(ctx, q, uniqueIDs(authorIDs))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// кандидаты по командам, из которых были назначены снятые ревьюверы
+	sources := make(map[uuid.UUID]*replacementPools)
+
+	var newPRIDs, newUserIDs, newTeamIDs []uuid.UUID
+	var history assignmentLog
+	// снятые без замены; заменённые попадают в ленту через history
+	var events eventLog
+	now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	for _, r := range removed {
+		item := Reassignment{PullRequestID: r.PrID.String(), OldUserID: r.UserID.String()}
+
+		srcID := team.ID
+		if r.TeamID.Valid {
+			srcID = r.TeamID.Bytes
+		}
+		src, ok := sources[srcID]
+		if !ok {
+			if src, err = newReplacementPools(ctx, q, srcID, team); err != nil {
+				return nil, nil, err
+			}
+			sources[srcID] = src
+		}
+		prStrategy := withSkills(withPairings(strategyOf(src.team), pairings[authorOf[r.PrID]]), requiredSkills[r.PrID])
+		picked, err := s.pickFromPools(ctx, q, src, prStrategy, busy[r.PrID], 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		picked, item.RelaxedRules, err = s.applyRules(ctx, q, src, rules[r.PrID], prStrategy, current[r.PrID], picked, busy[r.PrID], 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(picked) == 0 {
+			if err := events.add(r.PrID, prEvent{typ: EventReviewerRemoved, user: r.UserID}); err != nil {
+				return nil, nil, err
+			}
+			notReassigned = append(notReassigned, item)
+			continue
+		}
+
+		newID := picked[0].User.ID
+		// причину записываем по данным до учёта этого назначения
+		reason := assignmentReason{
+			reason:   AssignedReassignment,
+			replaced: r.UserID,
+			strategy: strategyNameOf(src.team),
+			required: requiredSkills[r.PrID],
+			pairs:    pairings[authorOf[r.PrID]],
+		}
+		inputs := reason.inputs(picked[0])
+		inputs.FromFallback = src.borrowed(picked[0])
+		if err := history.add(r.PrID, newID, picked[0].SourceTeam, reason, inputs); err != nil {
+			return nil, nil, err
+		}
+		current[r.PrID] = append(current[r.PrID], picked[0])
+		pairings[authorOf[r.PrID]][newID]++
+		// учитываем новое назначение при выборе для следующих PR
+		noteAssigned(sources, newID, now)
+
+		item.NewUserID = newID.String()
+		item.FromFallback = src.borrowed(picked[0])
+		reassigned = append(reassigned, item)
+		newPRIDs = append(newPRIDs, r.PrID)
+		newUserIDs = append(newUserIDs, newID)
+		newTeamIDs = append(newTeamIDs, picked[0].SourceTeam.Bytes)
+	}
+
+	if len(newPRIDs) > 0 {
+		if err := q.AddReviewersToPRs(ctx, db.AddReviewersToPRsParams{PrIds: newPRIDs, UserIds: newUserIDs, TeamIds: newTeamIDs}); err != nil {
+			return nil, nil, err
+		}
+		if err := history.write(ctx, q); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := events.write(ctx, q); err != nil {
+		return nil, nil, err
+	}
+	return reassigned, notReassigned, nil
+}
+
+// кандидаты на замену из одной команды: pools[0] - сама команда, дальше резервные;
+// резервные читаются один раз и только если понадобились
+type replacementPools struct {
+	team           db.Team
+	pools          [][]Candidate
+	reservesLoaded bool
+}
+
+// кандидат взят не из самой команды, а из резервной
+func (p *replacementPools) borrowed(c Candidate) bool {
+	return c.SourceTeam.Bytes != p.team.ID
+}
+
+// defaultTeam уже прочитана вызывающим, её не запрашиваем повторно
+func newReplacementPools(ctx context.Context, q *db.Queries, teamID uuid.UUID, defaultTeam db.Team) (*replacementPools, error) {
+	team := defaultTeam
+	if teamID != defaultTeam.ID {
+		var err error
+		if team, err = q.GetTeam(ctx, teamID); err != nil {
+			return nil, err
+		}
+	}
+	home, err := activeTeamPool(ctx, q, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return &replacementPools{team: team, pools: [][]Candidate{home}, reservesLoaded: teamID == uuid.Nil}, nil
+}
+
+// подбирает до n кандидатов из пулов src: сначала из самой команды, затем из резервных, которые
+// читаются при первой нужде. exclude - кто не может быть выбран; выбранные добавляются в него.
+func (s *Service) pickFromPools(ctx context.Context, q *db.Queries, src *replacementPools, strategy AssignmentStrategy, exclude map[uuid.UUID]bool, n int) ([]Candidate, error) {
+	var picked []Candidate
+	for i := 0; i < len(src.pools) && len(picked) < n; i++ {
+		got := strategy.Pick(s.rng, withoutExcluded(src.pools[i], exclude), n-len(picked))
+		for _, c := range got {
+			exclude[c.User.ID] = true
+		}
+		picked = append(picked, got...)
+		if i == len(src.pools)-1 && len(picked) < n && !src.reservesLoaded {
+			if err := s.loadReserves(ctx, q, src); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return picked, nil
+}
+
+// доводит выбранных picked до правил состава команды PR: к текущим ревьюверам current
+// добавляется n новых, заменять можно только новых. Если правила не выполняются, дочитываются
+// резервные пулы src. exclude обновляется по итоговому выбору.
+// Возвращает итоговых новых ревьюверов и правила, которые выполнить не удалось.
+func (s *Service) applyRules(ctx context.Context, q *db.Queries, src *replacementPools, rules seniorityRules, strategy AssignmentStrategy, current, picked []Candidate, exclude map[uuid.UUID]bool, n int) ([]Candidate, []string, error) {
+	all := slices.Concat(current, picked)
+	if n <= 0 || len(rules.requirements(all)) == 0 {
+		return picked, nil, nil
+	}
+	if !src.reservesLoaded {
+		if err := s.loadReserves(ctx, q, src); err != nil {
+			return nil, nil, err
+		}
+	}
+	var reserve []Candidate
+	for _, pool := range src.pools {
+		reserve = append(reserve, withoutExcluded(pool, exclude)...)
+	}
+	all, relaxed := rules.apply(s.rng, strategy, all, len(current), len(current)+n, reserve)
+	for _, c := range picked {
+		delete(exclude, c.User.ID)
+	}
+	picked = all[len(current):]
+	for _, c := range picked {
+		exclude[c.User.ID] = true
+	}
+	return picked, relaxed, nil
+}
+
+// дочитывает в src пулы резервных команд
+func (s *Service) loadReserves(ctx context.Context, q *db.Queries, src *replacementPools) error {
+	src.reservesLoaded = true
+	fallbacks, err := s.reserveTeams(ctx, q, src.team.ID)
+	if err != nil {
+		return err
+	}
+	for _, fb := range fallbacks {
+		pool, err := activeTeamPool(ctx, q, fb.ID)
+		if err != nil {
+			return err
+		}
+		src.pools = append(src.pools, pool)
+	}
+	return nil
+}
+
+// учитывает новое назначение id во всех прочитанных пулах, чтобы следующие выборы
+// видели обновлённую загрузку и лимиты
+func noteAssigned(sources map[uuid.UUID]*replacementPools, id uuid.UUID, at pgtype.Timestamptz) {
+	for _, src := range sources {
+		for _, pool := range src.pools {
+			for i := range pool {
+				if pool[i].User.ID == id {
+					pool[i].OpenReviews++
+					pool[i].LastAssignedAt = at
+				}
+			}
+		}
+	}
+}
+
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
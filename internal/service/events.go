@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+)
+
+// типы событий в ленте PR
+const (
+	EventCreated            = "created"
+	EventReviewerAssigned   = "reviewer_assigned"
+	EventReviewerReassigned = "reviewer_reassigned"
+	EventReviewerRemoved    = "reviewer_removed"
+	EventStatusChanged      = "status_changed"
+	EventMerged             = "merged"
+)
+
+// кто выполнил действие, записанное в событие PR
+const (
+	// пользователь из X-Actor-ID
+	ActorKindUser = "user"
+	// сам сервис: фоновые задачи
+	ActorKindSystem = "system"
+	// запрос без X-Actor-ID
+	ActorKindUnknown = "unknown"
+)
+
+// событие ленты PR
+type PREvent struct {
+	ID             int64  `json:"id"`
+	Type           string `json:"type"`
+	ActorKind      string `json:"actor_kind"`
+	ActorID        string `json:"actor_id,omitempty"`
+	UserID         string `json:"user_id,omitempty"`
+	ReplacedUserID string `json:"replaced_user_id,omitempty"`
+	FromStatus     string `json:"from_status,omitempty"`
+	ToStatus       string `json:"to_status,omitempty"`
+	// подробности события: причина назначения, слияние в обход политики
+	Details json.RawMessage `json:"details"`
+	At      string          `json:"at"`
+}
+
+type actorKey struct{}
+
+// автор изменений; id задан только для ActorKindUser
+type actor struct {
+	kind string
+	id   uuid.UUID
+}
+
+// WithActor отмечает ctx пользователем, от имени которого вносятся изменения;
+// он записывается в события PR. Существование пользователя проверяет CheckActor
+func WithActor(ctx context.Context, actorID uuid.UUID) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{kind: ActorKindUser, id: actorID})
+}
+
+// отмечает ctx как изменения самого сервиса (фоновые задачи)
+func systemActor(ctx context.Context) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{kind: ActorKindSystem})
+}
+
+// кто вносит изменения; без отметки - ActorKindUnknown
+func actorOf(ctx context.Context) actor {
+	if a, ok := ctx.Value(actorKey{}).(actor); ok {
+		return a
+	}
+	return actor{kind: ActorKindUnknown}
+}
+
+// CheckActor проверяет, что пользователь из X-Actor-ID существует
+func (s *Service) CheckActor(ctx context.Context, actorID uuid.UUID) error {
+	if _, err := s.store.GetUser(ctx, actorID); err != nil {
+		return fmt.Errorf("NOT_FOUND: actor not found")
+	}
+	return nil
+}
+
+// событие PR до записи
+type prEvent struct {
+	typ      string
+	user     uuid.UUID
+	replaced uuid.UUID
+	from     string
+	to       string
+	// nil - без подробностей
+	details any
+}
+
+// накапливает события, чтобы записать их одним запросом в порядке добавления
+type eventLog struct {
+	params db.RecordPREventsParams
+}
+
+func (l *eventLog) add(prID uuid.UUID, e prEvent) error {
+	raw := []byte("{}")
+	if e.details != nil {
+		var err error
+		if raw, err = json.Marshal(e.details); err != nil {
+			return err
+		}
+	}
+	p := &l.params
+	p.PrIds = append(p.PrIds, prID)
+	p.EventTypes = append(p.EventTypes, e.typ)
+	p.UserIds = append(p.UserIds, e.user)
+	p.ReplacedUserIds = append(p.ReplacedUserIds, e.replaced)
+	p.FromStatuses = append(p.FromStatuses, e.from)
+	p.ToStatuses = append(p.ToStatuses, e.to)
+	p.Details = append(p.Details, raw)
+	return nil
+}
+
+func (l *eventLog) write(ctx context.Context, q *db.Queries) error {
+	if len(l.params.PrIds) == 0 {
+		return nil
+	}
+	a := actorOf(ctx)
+	l.params.ActorIds = make([]uuid.UUID, len(l.params.PrIds))
+	l.params.ActorKinds = make([]string, len(l.params.PrIds))
+	for i := range l.params.ActorIds {
+		l.params.ActorIds[i] = a.id
+		l.params.ActorKinds[i] = a.kind
+	}
+	return q.RecordPREvents(ctx, l.params)
+}
+
+// записывает одно событие PR
+func recordEvent(ctx context.Context, q *db.Queries, prID uuid.UUID, e prEvent) error {
+	var l eventLog
+	if err := l.add(prID, e); err != nil {
+		return err
+	}
+	return l.write(ctx, q)
+}
+
+// лента событий PR от создания до текущего момента
+func (s *Service) GetPRTimeline(ctx context.Context, prIDStr string) ([]PREvent, error) {
+	prID, err := uuid.Parse(prIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pull_request_id format: %w", err)
+	}
+	if _, err := s.store.GetPullRequest(ctx, prID); err != nil {
+		return nil, fmt.Errorf("NOT_FOUND: PR not found")
+	}
+	rows, err := s.store.GetPREvents(ctx, prID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]PREvent, len(rows))
+	for i, r := range rows {
+		item := PREvent{
+			ID:         r.ID,
+			Type:       r.EventType,
+			ActorKind:  r.ActorKind,
+			FromStatus: r.FromStatus.String,
+			ToStatus:   r.ToStatus.String,
+			Details:    json.RawMessage(r.Details),
+			At:         r.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		}
+		if r.ActorID.Valid {
+			item.ActorID = uuid.UUID(r.ActorID.Bytes).String()
+		}
+		if r.UserID.Valid {
+			item.UserID = uuid.UUID(r.UserID.Bytes).String()
+		}
+		if r.ReplacedUserID.Valid {
+			item.ReplacedUserID = uuid.UUID(r.ReplacedUserID.Bytes).String()
+		}
+		result[i] = item
+	}
+	return result, nil
+}
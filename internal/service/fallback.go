@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+)
+
+// подбирает до n ревьюверов из резервных команд teamID (см. reserveTeams) по порядку.
+// exclude - кто уже не может быть выбран (автор, текущие ревьюверы); выбранные добавляются в него.
+func (s *Service) pickFromFallbacks(ctx context.Context, q *db.Queries, teamID uuid.UUID, strategy AssignmentStrategy, exclude map[uuid.UUID]bool, n int) ([]Candidate, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	fallbacks, err := s.reserveTeams(ctx, q, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	var picked []Candidate
+	for _, fb := range fallbacks {
+		pool, err := activeTeamPool(ctx, q, fb.ID)
+		if err != nil {
+			return nil, err
+		}
+		got := strategy.Pick(s.rng, withoutExcluded(pool, exclude), n-len(picked))
+		for _, c := range got {
+			exclude[c.User.ID] = true
+		}
+		picked = append(picked, got...)
+		if len(picked) >= n {
+			break
+		}
+	}
+	return picked, nil
+}
+
+// все доступные участники резервных команд teamID, кроме exclude, в порядке команд
+func (s *Service) fallbackReserve(ctx context.Context, q *db.Queries, teamID uuid.UUID, exclude map[uuid.UUID]bool) ([]Candidate, error) {
+	fallbacks, err := s.reserveTeams(ctx, q, teamID)
+	if err != nil {
+		return nil, err
+	}
+	var reserve []Candidate
+	for _, fb := range fallbacks {
+		pool, err := activeTeamPool(ctx, q, fb.ID)
+		if err != nil {
+			return nil, err
+		}
+		reserve = append(reserve, withoutExcluded(pool, exclude)...)
+	}
+	return reserve, nil
+}
+
+// активные участники команды в виде кандидатов
+func activeTeamPool(ctx context.Context, q *db.Queries, teamID uuid.UUID) ([]Candidate, error) {
+	rows, err := q.GetActiveTeamCandidates(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	pool := make([]Candidate, len(rows))
+	for i, r := range rows {
+		pool[i] = teamCandidate(r, teamID)
+	}
+	return pool, nil
+}
+
+// кандидаты пула, кроме исключённых и уже загруженных до лимита
+// (лимит может быть достигнут назначениями внутри текущей операции)
+func withoutExcluded(pool []Candidate, exclude map[uuid.UUID]bool) []Candidate {
+	out := make([]Candidate, 0, len(pool))
+	for _, c := range pool {
+		if !exclude[c.User.ID] && !c.atCapacity() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
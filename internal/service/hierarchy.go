@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// на сколько уровней вверх по дереву команд искать ревьюверов, если не задано опцией
+const DefaultEscalationDepth = 1
+
+// задаёт глубину поиска ревьюверов вверх по дереву команд; 0 - не подниматься
+func WithEscalationDepth(n int) Option {
+	return func(s *Service) {
+		if n >= 0 {
+			s.escalationDepth = n
+		}
+	}
+}
+
+// делает команду подкомандой parentName; пустой parentName делает её корневой
+func (s *Service) SetTeamParent(ctx context.Context, teamName, parentName string) (*TeamDetails, error) {
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		team, err := txq.GetTeamByName(ctx, teamName)
+		if err != nil {
+			return fmt.Errorf("NOT_FOUND: team not found")
+		}
+
+		parentID := pgtype.UUID{}
+		if parentName != "" {
+			parent, err := txq.GetTeamByName(ctx, parentName)
+			if err != nil {
+				return fmt.Errorf("PARENT_NOT_FOUND: parent team %s not found", parentName)
+			}
+			// родитель не может лежать в поддереве самой команды
+			for cur := parent; ; {
+				if cur.ID == team.ID {
+					return fmt.Errorf("TEAM_CYCLE: team %s cannot be placed under %s", teamName, parentName)
+				}
+				if !cur.ParentID.Valid {
+					break
+				}
+				if cur, err = txq.GetTeam(ctx, cur.ParentID.Bytes); err != nil {
+					return err
+				}
+			}
+			parentID = pgtype.UUID{Bytes: parent.ID, Valid: true}
+		}
+
+		if _, err := txq.SetTeamParent(ctx, db.SetTeamParentParams{ID: team.ID, ParentID: parentID}); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTeamDetails(ctx, teamName, false)
+}
+
+// подкоманды команды со всеми уровнями вложенности
+func (s *Service) subTeams(ctx context.Context, teamID uuid.UUID) ([]TeamDetails, error) {
+	children, err := s.store.GetChildTeams(ctx, pgtype.UUID{Bytes: teamID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]TeamDetails, 0, len(children))
+	for _, child := range children {
+		details, err := s.teamDetails(ctx, child)
+		if err != nil {
+			return nil, err
+		}
+		if details.SubTeams, err = s.subTeams(ctx, child.ID); err != nil {
+			return nil, err
+		}
+		result = append(result, *details)
+	}
+	return result, nil
+}
+
+// команды, из которых добираются ревьюверы, если своей не хватило: сначала резервные
+// в порядке приоритета, затем по дереву - соседние команды и родитель, потом уровнем выше,
+// не больше escalationDepth уровней
+func (s *Service) reserveTeams(ctx context.Context, q *db.Queries, teamID uuid.UUID) ([]db.Team, error) {
+	fallbacks, err := q.GetTeamFallbacks(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[uuid.UUID]bool{teamID: true}
+	result := make([]db.Team, 0, len(fallbacks))
+	add := func(t db.Team) {
+		if !seen[t.ID] {
+			seen[t.ID] = true
+			result = append(result, t)
+		}
+	}
+	for _, fb := range fallbacks {
+		add(fb)
+	}
+	if s.escalationDepth == 0 {
+		return result, nil
+	}
+
+	cur, err := q.GetTeam(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	for level := 0; level < s.escalationDepth && cur.ParentID.Valid; level++ {
+		siblings, err := q.GetChildTeams(ctx, cur.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		for _, sib := range siblings {
+			add(sib)
+		}
+		if cur, err = q.GetTeam(ctx, cur.ParentID.Bytes); err != nil {
+			return nil, err
+		}
+		add(cur)
+	}
+	return result, nil
+}
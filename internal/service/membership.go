@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// добавляет существующего пользователя в команду (или меняет его роль в ней).
+// Основная команда пользователя не меняется, если она уже есть.
+func (s *Service) AddTeamMember(ctx context.Context, teamName string, userID uuid.UUID, role string) (*TeamDetails, error) {
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		team, err := txq.GetTeamByName(ctx, teamName)
+		if err != nil {
+			return fmt.Errorf("NOT_FOUND: team not found")
+		}
+		user, err := txq.GetUser(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("USER_NOT_FOUND: user not found")
+		}
+
+		if err := txq.AddTeamMember(ctx, db.AddTeamMemberParams{
+			TeamID: team.ID,
+			UserID: user.ID,
+			Role:   pgtype.Text{String: role, Valid: role != ""},
+		}); err != nil {
+			return err
+		}
+		if !user.TeamID.Valid {
+			if _, err := txq.SetUserPrimaryTeam(ctx, db.SetUserPrimaryTeamParams{
+				ID:     user.ID,
+				TeamID: pgtype.UUID{Bytes: team.ID, Valid: true},
+			}); err != nil {
+				return err
+			}
+		}
+
+		// новый участник может закрыть нехватку ревьюверов на OPEN PR команды
+		_, err = s.topUpUnderstaffed(ctx, txq, topUpScope{teamIDs: []uuid.UUID{team.ID}})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTeamDetails(ctx, teamName, false)
+}
+
+// убирает пользователя из команды. Если это была его основная команда, основной становится
+// первая по имени из оставшихся (или никакая). Уже назначенные ревью не снимаются.
+func (s *Service) RemoveTeamMember(ctx context.Context, teamName string, userID uuid.UUID) (*TeamDetails, error) {
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		team, err := txq.GetTeamByName(ctx, teamName)
+		if err != nil {
+			return fmt.Errorf("NOT_FOUND: team not found")
+		}
+		n, err := txq.RemoveTeamMember(ctx, db.RemoveTeamMemberParams{TeamID: team.ID, UserID: userID})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("NOT_MEMBER: user is not a member of team %s", team.Name)
+		}
+
+		user, err := txq.GetUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !user.TeamID.Valid || user.TeamID.Bytes != team.ID {
+			return nil
+		}
+		primary := pgtype.UUID{}
+		teams, err := txq.GetUserTeams(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(teams) > 0 {
+			primary = pgtype.UUID{Bytes: teams[0].ID, Valid: true}
+		}
+		_, err = txq.SetUserPrimaryTeam(ctx, db.SetUserPrimaryTeamParams{ID: userID, TeamID: primary})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTeamDetails(ctx, teamName, false)
+}
+
+// делает одну из команд пользователя основной: по ней подбираются ревьюверы его PR,
+// если при создании PR команда не указана явно
+func (s *Service) SetPrimaryTeam(ctx context.Context, userID uuid.UUID, teamName string) (*UserDetails, error) {
+	details := &UserDetails{}
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		if _, err := txq.GetUser(ctx, userID); err != nil {
+			return fmt.Errorf("NOT_FOUND: user not found")
+		}
+		team, err := memberTeam(ctx, txq, userID, teamName)
+		if err != nil {
+			return err
+		}
+		details.User, err = txq.SetUserPrimaryTeam(ctx, db.SetUserPrimaryTeamParams{
+			ID:     userID,
+			TeamID: pgtype.UUID{Bytes: team.ID, Valid: true},
+		})
+		details.TeamName = team.Name
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// команда, по которой подбираются ревьюверы PR автора: явно указанная (автор должен в ней
+// состоять), иначе основная команда автора. ok=false - автор не состоит ни в одной команде.
+func prTeam(ctx context.Context, q *db.Queries, author db.User, teamName string) (db.Team, bool, error) {
+	if teamName != "" {
+		team, err := memberTeam(ctx, q, author.ID, teamName)
+		return team, err == nil, err
+	}
+	if !author.TeamID.Valid {
+		return db.Team{}, false, nil
+	}
+	team, err := q.GetTeam(ctx, author.TeamID.Bytes)
+	if err != nil {
+		return db.Team{}, false, err
+	}
+	return team, true, nil
+}
+
+// команда teamName, если пользователь в ней состоит
+func memberTeam(ctx context.Context, q *db.Queries, userID uuid.UUID, teamName string) (db.Team, error) {
+	teams, err := q.GetUserTeams(ctx, userID)
+	if err != nil {
+		return db.Team{}, err
+	}
+	for _, t := range teams {
+		if t.Name == teamName {
+			return t, nil
+		}
+	}
+	if _, err := q.GetTeamByName(ctx, teamName); err != nil {
+		return db.Team{}, fmt.Errorf("TEAM_NOT_FOUND: team %s not found", teamName)
+	}
+	return db.Team{}, fmt.Errorf("NOT_TEAM_MEMBER: user is not a member of team %s", teamName)
+}
+
+// команда, из которой подбирается замена ревьюверу PR: та, через которую он был назначен,
+// а если он назначен не через команду (владелец кода, вручную) - его основная команда
+func replacementTeam(ctx context.Context, q *db.Queries, prID uuid.UUID, reviewer db.User) (pgtype.UUID, error) {
+	teamID, err := q.GetReviewerTeam(ctx, db.GetReviewerTeamParams{PrID: prID, UserID: reviewer.ID})
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+	if teamID.Valid {
+		return teamID, nil
+	}
+	return reviewer.TeamID, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/jackc/pgx/v5"
+)
+
+// нарушения политики слияния команды PR по текущим решениям ревьюверов;
+// у PR без команды политики нет
+func mergePolicyViolations(ctx context.Context, q *db.Queries, pr db.PullRequest) ([]string, error) {
+	if !pr.TeamID.Valid {
+		return nil, nil
+	}
+	team, err := q.GetTeam(ctx, pr.TeamID.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.GetReviewVerdicts(ctx, pr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := 0
+	var changesRequested []string
+	for _, r := range rows {
+		switch r.Verdict.String {
+		case VerdictApproved:
+			approvals++
+		case VerdictChangesRequested:
+			changesRequested = append(changesRequested, r.UserID.String())
+		}
+	}
+
+	var violations []string
+	if approvals < int(team.MinApprovals) {
+		violations = append(violations, fmt.Sprintf("%d of %d required approvals", approvals, team.MinApprovals))
+	}
+	if team.BlockOnChangesRequested && len(changesRequested) > 0 {
+		violations = append(violations, "changes requested by "+strings.Join(changesRequested, ", "))
+	}
+	return violations, nil
+}
+
+// подробности события слияния
+type mergeEventDetails struct {
+	Forced bool `json:"forced"`
+	// нарушенные правила политики, в обход которых слит PR
+	Violations []string `json:"violations,omitempty"`
+}
+
+// роль участника команды, которому разрешено сливать PR в обход политики команды
+const RoleAdmin = "admin"
+
+// слить PR в обход политики может только admin команды PR, указанный в X-Actor-ID
+func canForceMerge(ctx context.Context, q *db.Queries, pr db.PullRequest) (bool, error) {
+	a := actorOf(ctx)
+	if a.kind != ActorKindUser || !pr.TeamID.Valid {
+		return false, nil
+	}
+	role, err := q.GetTeamMemberRole(ctx, db.GetTeamMemberRoleParams{TeamID: pr.TeamID.Bytes, UserID: a.id})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return role.String == RoleAdmin, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// окно истории пар автор -> ревьювер, если не задано опцией WithPairingWindow
+const DefaultPairingWindow = 30 * 24 * time.Hour
+
+// сколько раз ревьювер назначался на PR автора
+type PairCount struct {
+	AuthorID   string `json:"author_id"`
+	ReviewerID string `json:"reviewer_id"`
+	Count      int64  `json:"count"`
+}
+
+// пары одной команды (по команде, за которой числится PR)
+type TeamPairs struct {
+	TeamName string      `json:"team_name"`
+	Pairs    []PairCount `json:"pairs"`
+	// matrix[author_id][reviewer_id] = число назначений
+	Matrix map[string]map[string]int64 `json:"matrix"`
+}
+
+type PairStats struct {
+	Window string      `json:"window"`
+	Teams  []TeamPairs `json:"teams"`
+}
+
+// задаёт окно, за которое учитываются прошлые пары автор -> ревьювер; 0 - не учитывать
+func WithPairingWindow(d time.Duration) Option {
+	return func(s *Service) {
+		if d >= 0 {
+			s.pairingWindow = d
+		}
+	}
+}
+
+// получает матрицу пар автор -> ревьювер за окно истории по командам
+func (s *Service) GetPairStats(ctx context.Context) (*PairStats, error) {
+	rows, err := s.store.GetPairCountsByTeam(ctx, s.pairingSince())
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &PairStats{Window: s.pairingWindow.String(), Teams: make([]TeamPairs, 0)}
+	for _, r := range rows {
+		if n := len(stats.Teams); n == 0 || stats.Teams[n-1].TeamName != r.TeamName {
+			stats.Teams = append(stats.Teams, TeamPairs{
+				TeamName: r.TeamName,
+				Pairs:    make([]PairCount, 0),
+				Matrix:   make(map[string]map[string]int64),
+			})
+		}
+		team := &stats.Teams[len(stats.Teams)-1]
+		author, reviewer := r.AuthorID.String(), r.ReviewerID.String()
+		team.Pairs = append(team.Pairs, PairCount{AuthorID: author, ReviewerID: reviewer, Count: r.Pairs})
+		if team.Matrix[author] == nil {
+			team.Matrix[author] = make(map[string]int64)
+		}
+		team.Matrix[author][reviewer] = r.Pairs
+	}
+	return stats, nil
+}
+
+// начало окна истории пар; при нулевом окне - вся история
+func (s *Service) pairingSince() pgtype.Timestamptz {
+	if s.pairingWindow == 0 {
+		return pgtype.Timestamptz{Time: time.Time{}, Valid: true}
+	}
+	return pgtype.Timestamptz{Time: time.Now().Add(-s.pairingWindow), Valid: true}
+}
+
+// недавние пары для авторов: pairings[author][reviewer] = число назначений за окно
+func (s *Service) recentPairings(ctx context.Context, q *db.Queries, authorIDs []uuid.UUID) (map[uuid.UUID]map[uuid.UUID]int64, error) {
+	pairings := make(map[uuid.UUID]map[uuid.UUID]int64, len(authorIDs))
+	for _, id := range authorIDs {
+		pairings[id] = make(map[uuid.UUID]int64)
+	}
+	if s.pairingWindow == 0 || len(authorIDs) == 0 {
+		return pairings, nil
+	}
+
+	rows, err := q.GetRecentPairCounts(ctx, db.GetRecentPairCountsParams{AuthorIds: authorIDs, Since: s.pairingSince()})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		pairings[r.AuthorID][r.ReviewerID] = r.Pairs
+	}
+	return pairings, nil
+}
+
+// оборачивает стратегию штрафом за недавние пары с автором
+func withPairings(base AssignmentStrategy, pairs map[uuid.UUID]int64) AssignmentStrategy {
+	if len(pairs) == 0 {
+		return base
+	}
+	return pairingPenaltyStrategy{base: base, pairs: pairs}
+}
+
+// сначала выбираются те, кто реже ревьювил автора за окно истории; внутри группы с
+// одинаковым числом пар решает стратегия команды
+type pairingPenaltyStrategy struct {
+	base  AssignmentStrategy
+	pairs map[uuid.UUID]int64
+}
+
+func (p pairingPenaltyStrategy) Pick(rng *rand.Rand, candidates []Candidate, n int) []Candidate {
+	groups := make(map[int64][]Candidate)
+	for _, c := range candidates {
+		k := p.pairs[c.User.ID]
+		groups[k] = append(groups[k], c)
+	}
+	keys := make([]int64, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, cmp.Compare[int64])
+
+	picked := make([]Candidate, 0, min(n, len(candidates)))
+	for _, k := range keys {
+		if len(picked) >= n {
+			break
+		}
+		picked = append(picked, p.base.Pick(rng, groups[k], n-len(picked))...)
+	}
+	return picked
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+)
+
+// почему участник команды не может быть назначен ревьювером
+const (
+	ExcludedAuthor     = "author"
+	ExcludedInactive   = "inactive"
+	ExcludedAbsent     = "absent"
+	ExcludedAtCapacity = "at_capacity"
+)
+
+// кандидат в предпросмотре назначения
+type PreviewCandidate struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	// команда, через которую кандидат рассматривается; пусто - владелец кода вне этих команд
+	TeamName    string `json:"team_name,omitempty"`
+	OpenReviews int64  `json:"open_reviews"`
+	Eligible    bool   `json:"eligible"`
+	Selected    bool   `json:"selected"`
+	// место в порядке выбора среди подходящих, начиная с 1; выбранные идут первыми
+	Rank int `json:"rank,omitempty"`
+	// причина, по которой кандидат не подходит (Excluded*)
+	ExcludedReason string `json:"excluded_reason,omitempty"`
+}
+
+// кого бы назначили ревьюверами при создании PR с такими параметрами
+type AssignmentPreview struct {
+	AuthorID           string   `json:"author_id"`
+	TeamName           string   `json:"team_name,omitempty"`
+	RequestedReviewers int      `json:"requested_reviewers"`
+	Reviewers          []string `json:"reviewers"`
+	MissingReviewers   int      `json:"missing_reviewers,omitempty"`
+	OwnerReviewers     []string `json:"owner_reviewers,omitempty"`
+	FallbackReviewers  []string `json:"fallback_reviewers,omitempty"`
+	CapacityLimited    bool     `json:"capacity_limited,omitempty"`
+	RelaxedRules       []string `json:"relaxed_rules,omitempty"`
+	// все рассмотренные кандидаты: сначала подходящие по рангу, затем исключённые
+	Candidates []PreviewCandidate `json:"candidates"`
+}
+
+// подбирает ревьюверов так же, как CreatePullRequest, но ничего не записывает.
+// Выбор случайных стратегий не закреплён: реальное создание PR может выбрать других.
+func (s *Service) PreviewAssignment(ctx context.Context, authorIDStr string, opts CreatePROptions) (*AssignmentPreview, error) {
+	if opts.ReviewersCount != nil {
+		if err := s.validateReviewersCount(*opts.ReviewersCount); err != nil {
+			return nil, err
+		}
+	}
+	authorID, err := uuid.Parse(authorIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid author_id format: %w", err)
+	}
+
+	// у предпросмотра свой одноразовый генератор: общий он не сдвигает, и назначения
+	// с фиксированным seed остаются воспроизводимыми
+	ps := *s
+	ps.rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+
+	var preview *AssignmentPreview
+	// только чтение; транзакция даёт согласованный снимок
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		author, err := txq.GetUser(ctx, authorID)
+		if err != nil {
+			return fmt.Errorf("author not found")
+		}
+		sel, err := ps.selectReviewers(ctx, txq, author, opts)
+		if err != nil {
+			return err
+		}
+
+		preview = &AssignmentPreview{
+			AuthorID:           authorID.String(),
+			RequestedReviewers: sel.requested,
+			Reviewers:          make([]string, 0, len(sel.reviewers)),
+			MissingReviewers:   sel.requested - len(sel.reviewers),
+			FallbackReviewers:  sel.fallbackReviewerIDs(),
+			CapacityLimited:    sel.capacityLimited,
+			RelaxedRules:       sel.relaxed,
+		}
+		for _, c := range sel.owners {
+			preview.OwnerReviewers = append(preview.OwnerReviewers, c.User.ID.String())
+		}
+
+		// команды в порядке, в котором из них берутся ревьюверы
+		var teams []db.Team
+		if sel.hasTeam {
+			preview.TeamName = sel.team.Name
+			reserve, err := ps.reserveTeams(ctx, txq, sel.team.ID)
+			if err != nil {
+				return err
+			}
+			teams = append([]db.Team{sel.team}, reserve...)
+		}
+		teamNames := make(map[uuid.UUID]string, len(teams))
+		for _, t := range teams {
+			teamNames[t.ID] = t.Name
+		}
+
+		seen := make(map[uuid.UUID]bool)
+		rank := 0
+		for _, c := range sel.reviewers {
+			seen[c.User.ID] = true
+			rank++
+			preview.Reviewers = append(preview.Reviewers, c.User.ID.String())
+			preview.Candidates = append(preview.Candidates, PreviewCandidate{
+				UserID:      c.User.ID.String(),
+				Username:    c.User.Name,
+				TeamName:    teamNames[c.SourceTeam.Bytes],
+				OpenReviews: c.OpenReviews,
+				Eligible:    true,
+				Selected:    true,
+				Rank:        rank,
+			})
+		}
+
+		// остальные подходящие - в порядке, в котором их выбрала бы стратегия
+		for _, t := range teams {
+			pool, err := activeTeamPool(ctx, txq, t.ID)
+			if err != nil {
+				return err
+			}
+			for _, c := range sel.strategy.Pick(ps.rng, withoutExcluded(pool, seen), len(pool)) {
+				if c.User.ID == authorID {
+					continue
+				}
+				seen[c.User.ID] = true
+				rank++
+				preview.Candidates = append(preview.Candidates, PreviewCandidate{
+					UserID:      c.User.ID.String(),
+					Username:    c.User.Name,
+					TeamName:    t.Name,
+					OpenReviews: c.OpenReviews,
+					Eligible:    true,
+					Rank:        rank,
+				})
+			}
+		}
+
+		// исключённые - с причиной
+		teamIDs := make([]uuid.UUID, len(teams))
+		for i, t := range teams {
+			teamIDs[i] = t.ID
+		}
+		members, err := txq.GetTeamMembersAvailability(ctx, teamIDs)
+		if err != nil {
+			return err
+		}
+		for _, t := range teams {
+			for _, m := range members {
+				if m.TeamID != t.ID || seen[m.ID] {
+					continue
+				}
+				seen[m.ID] = true
+				preview.Candidates = append(preview.Candidates, PreviewCandidate{
+					UserID:         m.ID.String(),
+					Username:       m.Name,
+					TeamName:       t.Name,
+					OpenReviews:    m.OpenReviews,
+					ExcludedReason: excludedReason(m, authorID),
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+func excludedReason(m db.GetTeamMembersAvailabilityRow, authorID uuid.UUID) string {
+	switch {
+	case m.ID == authorID:
+		return ExcludedAuthor
+	case !m.IsActive:
+		return ExcludedInactive
+	case m.IsAbsent:
+		return ExcludedAbsent
+	default:
+		return ExcludedAtCapacity
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// как ревьювер попал на PR
+const (
+	AssignedInitial      = "initial"
+	AssignedOwner        = "owner"
+	AssignedFallback     = "fallback"
+	AssignedReassignment = "reassignment"
+	AssignedManual       = "manual"
+	AssignedTopUp        = "top_up"
+)
+
+// данные, по которым выбирался ревьювер, на момент назначения
+type AssignmentInputs struct {
+	OpenReviews    int64    `json:"open_reviews"`
+	MaxOpenReviews *int32   `json:"max_open_reviews,omitempty"`
+	Seniority      string   `json:"seniority,omitempty"`
+	MatchedSkills  []string `json:"matched_skills,omitempty"`
+	// сколько раз ревьювер был назначен на PR автора за окно истории
+	RecentPairs  int64 `json:"recent_pairs,omitempty"`
+	FromFallback bool  `json:"from_fallback,omitempty"`
+	// замену явно указал тот, кто переназначал
+	Requested bool `json:"requested,omitempty"`
+}
+
+// запись истории назначений PR; снятые ревьюверы остаются с removed_at
+type AssignmentRationale struct {
+	UserID         string          `json:"user_id"`
+	Reason         string          `json:"reason"`
+	ReplacedUserID string          `json:"replaced_user_id,omitempty"`
+	TeamName       string          `json:"team_name,omitempty"`
+	Strategy       string          `json:"strategy,omitempty"`
+	Inputs         json.RawMessage `json:"inputs"`
+	AssignedAt     string          `json:"assigned_at"`
+	RemovedAt      *string         `json:"removed_at,omitempty"`
+}
+
+// общий для назначений на один PR контекст выбора
+type assignmentReason struct {
+	reason   string
+	replaced uuid.UUID
+	strategy string
+	// требуемые навыки PR и недавние пары с его автором
+	required []string
+	pairs    map[uuid.UUID]int64
+}
+
+// входные данные выбора кандидата c
+func (a assignmentReason) inputs(c Candidate) *AssignmentInputs {
+	in := &AssignmentInputs{
+		OpenReviews: c.OpenReviews,
+		Seniority:   c.User.Seniority,
+		RecentPairs: a.pairs[c.User.ID],
+	}
+	if c.MaxOpenReviews.Valid {
+		limit := c.MaxOpenReviews.Int32
+		in.MaxOpenReviews = &limit
+	}
+	for _, skill := range a.required {
+		if slices.Contains(c.User.Skills, skill) {
+			in.MatchedSkills = append(in.MatchedSkills, skill)
+		}
+	}
+	return in
+}
+
+// накапливает назначения, чтобы записать их одним запросом
+type assignmentLog struct {
+	params db.RecordAssignmentsParams
+}
+
+// inputs == nil - ревьювер выбран не по данным (ручное добавление)
+func (l *assignmentLog) add(prID, userID uuid.UUID, teamID pgtype.UUID, a assignmentReason, inputs *AssignmentInputs) error {
+	raw := []byte("{}")
+	if inputs != nil {
+		var err error
+		if raw, err = json.Marshal(inputs); err != nil {
+			return err
+		}
+	}
+	team := uuid.Nil
+	if teamID.Valid {
+		team = teamID.Bytes
+	}
+	p := &l.params
+	p.PrIds = append(p.PrIds, prID)
+	p.UserIds = append(p.UserIds, userID)
+	p.Reasons = append(p.Reasons, a.reason)
+	p.ReplacedUserIds = append(p.ReplacedUserIds, a.replaced)
+	p.TeamIds = append(p.TeamIds, team)
+	p.Strategies = append(p.Strategies, a.strategy)
+	p.Inputs = append(p.Inputs, raw)
+	return nil
+}
+
+// записывает назначения в историю и в ленту событий их PR
+func (l *assignmentLog) write(ctx context.Context, q *db.Queries) error {
+	if len(l.params.PrIds) == 0 {
+		return nil
+	}
+	if err := q.RecordAssignments(ctx, l.params); err != nil {
+		return err
+	}
+	var events eventLog
+	for i, prID := range l.params.PrIds {
+		e := prEvent{
+			typ:      EventReviewerAssigned,
+			user:     l.params.UserIds[i],
+			replaced: l.params.ReplacedUserIds[i],
+			details:  map[string]string{"reason": l.params.Reasons[i]},
+		}
+		if e.replaced != uuid.Nil {
+			e.typ = EventReviewerReassigned
+		}
+		if err := events.add(prID, e); err != nil {
+			return err
+		}
+	}
+	return events.write(ctx, q)
+}
+
+// записывает одно назначение кандидата c
+func recordAssignment(ctx context.Context, q *db.Queries, prID uuid.UUID, c Candidate, a assignmentReason, inputs *AssignmentInputs) error {
+	var l assignmentLog
+	if err := l.add(prID, c.User.ID, c.SourceTeam, a, inputs); err != nil {
+		return err
+	}
+	return l.write(ctx, q)
+}
+
+// отмечает в истории снятие ревьювера с PR
+func closeAssignment(ctx context.Context, q *db.Queries, prID, userID uuid.UUID) error {
+	return q.CloseAssignments(ctx, db.CloseAssignmentsParams{PrIds: []uuid.UUID{prID}, UserIds: []uuid.UUID{userID}})
+}
+
+// имя стратегии, которой команда выбирает ревьюверов
+func strategyNameOf(team db.Team) string {
+	if team.AssignmentStrategy.Valid {
+		if _, ok := StrategyByName(team.AssignmentStrategy.String); ok {
+			return team.AssignmentStrategy.String
+		}
+	}
+	return DefaultStrategy
+}
+
+// история назначений PR, включая снятых ревьюверов, в порядке назначения
+func (s *Service) GetAssignmentRationale(ctx context.Context, prIDStr string) ([]AssignmentRationale, error) {
+	prID, err := uuid.Parse(prIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pull_request_id format: %w", err)
+	}
+	rows, err := s.store.GetAssignmentsForPR(ctx, prID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]AssignmentRationale, len(rows))
+	for i, r := range rows {
+		item := AssignmentRationale{
+			UserID:     r.UserID.String(),
+			Reason:     r.Reason,
+			TeamName:   r.TeamName.String,
+			Strategy:   r.Strategy.String,
+			Inputs:     json.RawMessage(r.Inputs),
+			AssignedAt: r.AssignedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		}
+		if r.ReplacedUserID.Valid {
+			item.ReplacedUserID = uuid.UUID(r.ReplacedUserID.Bytes).String()
+		}
+		if r.RemovedAt.Valid {
+			removedAt := r.RemovedAt.Time.Format("2006-01-02T15:04:05Z07:00")
+			item.RemovedAt = &removedAt
+		}
+		result[i] = item
+	}
+	return result, nil
+}
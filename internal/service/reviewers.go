@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+)
+
+// вручную добавляет ревьювера на PR (например, третьего на рискованное изменение)
+func (s *Service) AddReviewer(ctx context.Context, prIDStr, userIDStr string) (*PRDetails, error) {
+	prID, userID, err := parsePRAndUser(prIDStr, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var details *PRDetails
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		pr, err := editablePR(ctx, txq, prID)
+		if err != nil {
+			return err
+		}
+		if pr.AuthorID == userID {
+			return fmt.Errorf("SELF_REVIEW: author cannot review own PR")
+		}
+		user, err := txq.GetUser(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("NOT_FOUND: user not found")
+		}
+		if !user.IsActive {
+			return fmt.Errorf("USER_INACTIVE: only active users can be reviewers")
+		}
+
+		reviewers, err := txq.GetReviewersForPR(ctx, prID)
+		if err != nil {
+			return err
+		}
+		for _, r := range reviewers {
+			if r.ID == userID {
+				return fmt.Errorf("ALREADY_ASSIGNED: user is already a reviewer of this PR")
+			}
+		}
+		if len(reviewers) >= s.maxReviewers {
+			return fmt.Errorf("TOO_MANY_REVIEWERS: PR already has the maximum of %d reviewers", s.maxReviewers)
+		}
+
+		if err := txq.AddReviewerToPR(ctx, db.AddReviewerToPRParams{PrID: prID, UserID: userID}); err != nil {
+			return err
+		}
+		if err := recordAssignment(ctx, txq, prID, Candidate{User: user}, assignmentReason{reason: AssignedManual}, nil); err != nil {
+			return err
+		}
+		// добавленный сверх цели ревьювер становится частью цели
+		if n := int32(len(reviewers) + 1); n > pr.TargetReviewers {
+			if err := txq.SetPullRequestTargetReviewers(ctx, db.SetPullRequestTargetReviewersParams{ID: prID, TargetReviewers: n}); err != nil {
+				return err
+			}
+		}
+		if pr, err = txq.TouchPullRequest(ctx, prID); err != nil {
+			return err
+		}
+		details, err = loadPRDetails(ctx, txq, pr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// вручную снимает ревьювера с PR без замены
+func (s *Service) RemoveReviewer(ctx context.Context, prIDStr, userIDStr string) (*PRDetails, error) {
+	prID, userID, err := parsePRAndUser(prIDStr, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var details *PRDetails
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		pr, err := editablePR(ctx, txq, prID)
+		if err != nil {
+			return err
+		}
+
+		reviewers, err := txq.GetReviewersForPR(ctx, prID)
+		if err != nil {
+			return err
+		}
+		isAssigned := false
+		for _, r := range reviewers {
+			if r.ID == userID {
+				isAssigned = true
+				break
+			}
+		}
+		if !isAssigned {
+			return fmt.Errorf("NOT_ASSIGNED: reviewer is not assigned to this PR")
+		}
+
+		if err := txq.RemoveReviewerFromPR(ctx, db.RemoveReviewerFromPRParams{PrID: prID, UserID: userID}); err != nil {
+			return err
+		}
+		if err := closeAssignment(ctx, txq, prID, userID); err != nil {
+			return err
+		}
+		if err := recordEvent(ctx, txq, prID, prEvent{typ: EventReviewerRemoved, user: userID}); err != nil {
+			return err
+		}
+		// снятие без замены уменьшает цель, иначе добор вернул бы ревьювера обратно
+		if n := int32(len(reviewers) - 1); n < pr.TargetReviewers {
+			if err := txq.SetPullRequestTargetReviewers(ctx, db.SetPullRequestTargetReviewersParams{ID: prID, TargetReviewers: n}); err != nil {
+				return err
+			}
+		}
+		if pr, err = txq.TouchPullRequest(ctx, prID); err != nil {
+			return err
+		}
+		details, err = loadPRDetails(ctx, txq, pr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// PR с текущим составом ревьюверов
+func (s *Service) GetPullRequest(ctx context.Context, prIDStr string) (*PRDetails, error) {
+	prID, err := uuid.Parse(prIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pull_request_id format: %w", err)
+	}
+
+	var details *PRDetails
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		pr, err := txq.GetPullRequest(ctx, prID)
+		if err != nil {
+			return fmt.Errorf("NOT_FOUND: PR not found")
+		}
+		details, err = loadPRDetails(ctx, txq, pr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+func parsePRAndUser(prIDStr, userIDStr string) (uuid.UUID, uuid.UUID, error) {
+	prID, err := uuid.Parse(prIDStr)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid pull_request_id format: %w", err)
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid user_id format: %w", err)
+	}
+	return prID, userID, nil
+}
+
+// PR, состав ревьюверов которого ещё можно менять; строка блокируется до конца транзакции,
+// чтобы слияние или закрытие не прошли между проверкой и изменением
+func editablePR(ctx context.Context, q *db.Queries, prID uuid.UUID) (db.PullRequest, error) {
+	pr, err := q.GetPullRequestForUpdate(ctx, prID)
+	if err != nil {
+		return db.PullRequest{}, fmt.Errorf("NOT_FOUND: PR not found")
+	}
+	if err := reviewersFrozen(pr); err != nil {
+		return db.PullRequest{}, err
+	}
+	return pr, nil
+}
+
+// детали PR с текущим составом ревьюверов и их решениями
+func loadPRDetails(ctx context.Context, q *db.Queries, pr db.PullRequest) (*PRDetails, error) {
+	reviewers, err := q.GetReviewersForPR(ctx, pr.ID)
+	if err != nil {
+		return nil, err
+	}
+	reviewerIDs := make([]string, len(reviewers))
+	for i, r := range reviewers {
+		reviewerIDs[i] = r.ID.String()
+	}
+	verdictRows, err := q.GetReviewVerdicts(ctx, pr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &PRDetails{
+		PullRequestID:     pr.ID.String(),
+		PullRequestName:   pr.Title,
+		AuthorID:          pr.AuthorID.String(),
+		Status:            pr.Status,
+		AssignedReviewers: reviewerIDs,
+		RequiredSkills:    pr.RequiredSkills,
+		CreatedAt:         formatTime(pr.CreatedAt),
+		UpdatedAt:         formatTime(pr.UpdatedAt),
+		MergedAt:          formatTime(pr.MergedAt),
+		Verdicts:          verdictsOf(verdictRows),
+		MergeForced:       pr.MergeForced,
+		MergeViolations:   pr.MergeViolations,
+	}
+	if pr.MergeForcedBy.Valid {
+		details.MergeForcedBy = uuid.UUID(pr.MergeForcedBy.Bytes).String()
+	}
+	return details, nil
+}
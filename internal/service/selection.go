@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// результат подбора ревьюверов для нового PR; ничего не записано в базу
+type reviewerSelection struct {
+	// команда PR; hasTeam=false - автор не состоит ни в одной команде
+	team    db.Team
+	hasTeam bool
+	// сколько ревьюверов требовалось
+	requested int
+	// выбранные ревьюверы в порядке выбора: владельцы кода, команда, резервные команды
+	reviewers []Candidate
+	owners    []Candidate
+	// выбранные и запасные кандидаты, взятые из резервных команд
+	fromFallback map[uuid.UUID]bool
+	// стратегия с учётом навыков и недавних пар; по ней же ранжируются остальные кандидаты
+	strategy AssignmentStrategy
+	// имя стратегии команды, навыки PR и недавние пары с автором - для истории назначений
+	strategyName    string
+	required        []string
+	pairs           map[uuid.UUID]int64
+	capacityLimited bool
+	relaxed         []string
+}
+
+// подбирает ревьюверов для PR автора по тем же правилам, что и при создании PR:
+// сначала владельцы изменённых файлов, затем команда PR, затем резервные команды,
+// после чего применяются правила состава команды. Только читает данные.
+func (s *Service) selectReviewers(ctx context.Context, q *db.Queries, author db.User, opts CreatePROptions) (*reviewerSelection, error) {
+	sel := &reviewerSelection{fromFallback: make(map[uuid.UUID]bool)}
+
+	strategy, _ := StrategyByName(DefaultStrategy)
+	sel.strategyName = DefaultStrategy
+	var err error
+	if sel.team, sel.hasTeam, err = prTeam(ctx, q, author, opts.TeamName); err != nil {
+		return nil, err
+	}
+	var teamID pgtype.UUID
+	if sel.hasTeam {
+		teamID = pgtype.UUID{Bytes: sel.team.ID, Valid: true}
+		strategy = strategyOf(sel.team)
+		sel.strategyName = strategyNameOf(sel.team)
+	}
+	sel.requested = s.reviewersWanted(sel.team, sel.hasTeam, opts.ReviewersCount)
+	requested := sel.requested
+
+	pairings, err := s.recentPairings(ctx, q, []uuid.UUID{author.ID})
+	if err != nil {
+		return nil, err
+	}
+	sel.required, sel.pairs = normalizeSkills(opts.RequiredSkills), pairings[author.ID]
+	strategy = withSkills(withPairings(strategy, sel.pairs), sel.required)
+	sel.strategy = strategy
+
+	exclude := map[uuid.UUID]bool{author.ID: true}
+
+	// сначала владельцы изменённых файлов
+	if len(opts.ChangedFiles) > 0 && requested > 0 {
+		rules, err := ownershipRulesFor(ctx, q, opts.Repository, teamID)
+		if err != nil {
+			return nil, err
+		}
+		if ownerIDs := ownersOfFiles(rules, opts.ChangedFiles); len(ownerIDs) > 0 {
+			ownerRows, err := q.GetActiveCandidatesByIDs(ctx, db.GetActiveCandidatesByIDsParams{TeamID: teamID, Ids: ownerIDs})
+			if err != nil {
+				return nil, err
+			}
+			// владельцы берутся по рангу из ownersOfFiles, а не по стратегии команды
+			ownerPool := withoutExcluded(rankedOwners(ownerIDs, ownerRows), exclude)
+			sel.owners = ownerPool[:min(requested, len(ownerPool))]
+			for _, c := range sel.owners {
+				exclude[c.User.ID] = true
+			}
+		}
+	}
+
+	// затем команда PR
+	var candidates []Candidate
+	if sel.hasTeam {
+		rows, err := q.GetCandidatesForInitialReview(ctx, db.GetCandidatesForInitialReviewParams{
+			TeamID:   sel.team.ID,
+			AuthorID: author.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		candidates = make([]Candidate, len(rows))
+		for i, r := range rows {
+			candidates[i] = initialCandidate(r, sel.team.ID)
+		}
+	}
+	picked := strategy.Pick(s.rng, withoutExcluded(candidates, exclude), requested-len(sel.owners))
+	for _, c := range picked {
+		exclude[c.User.ID] = true
+	}
+
+	// своей команды не хватило - добираем из резервных
+	var borrowed []Candidate
+	if missing := requested - len(sel.owners) - len(picked); missing > 0 && sel.hasTeam {
+		if borrowed, err = s.pickFromFallbacks(ctx, q, sel.team.ID, strategy, exclude, missing); err != nil {
+			return nil, err
+		}
+	}
+
+	all := slices.Concat(sel.owners, picked, borrowed)
+	for _, c := range borrowed {
+		sel.fromFallback[c.User.ID] = true
+	}
+
+	// правила состава команды; владельцев кода не заменяем
+	rules := seniorityRulesOf(sel.team)
+	if requested > 0 && len(rules.requirements(all)) > 0 {
+		reserve := withoutExcluded(candidates, exclude)
+		if sel.hasTeam {
+			fbReserve, err := s.fallbackReserve(ctx, q, sel.team.ID, exclude)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range fbReserve {
+				sel.fromFallback[c.User.ID] = true
+			}
+			reserve = append(reserve, fbReserve...)
+		}
+		all, sel.relaxed = rules.apply(s.rng, strategy, all, len(sel.owners), requested, reserve)
+		for _, c := range all {
+			exclude[c.User.ID] = true
+		}
+	}
+	sel.reviewers = all
+
+	if len(all) < requested && sel.hasTeam {
+		if sel.capacityLimited, err = s.capacityLimited(ctx, q, sel.team.ID, exclude); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+// сколько ревьюверов нужно PR: из запроса, иначе из настроек команды
+func (s *Service) reviewersWanted(team db.Team, hasTeam bool, count *int) int {
+	switch {
+	case count != nil:
+		return *count
+	case hasTeam:
+		return min(int(team.ReviewersCount), s.maxReviewers)
+	}
+	return 2
+}
+
+// команда и число ревьюверов для черновика: сами ревьюверы подбираются, когда он будет готов
+func (s *Service) draftSelection(ctx context.Context, q *db.Queries, author db.User, opts CreatePROptions) (*reviewerSelection, error) {
+	sel := &reviewerSelection{fromFallback: make(map[uuid.UUID]bool)}
+	var err error
+	if sel.team, sel.hasTeam, err = prTeam(ctx, q, author, opts.TeamName); err != nil {
+		return nil, err
+	}
+	sel.requested = s.reviewersWanted(sel.team, sel.hasTeam, opts.ReviewersCount)
+	return sel, nil
+}
+
+// назначает выбранных ревьюверов на PR и записывает причины назначений
+func assignSelected(ctx context.Context, q *db.Queries, prID uuid.UUID, sel *reviewerSelection) ([]string, error) {
+	assigned := make([]string, 0, len(sel.reviewers))
+	for _, c := range sel.reviewers {
+		if err := q.AddReviewerToPR(ctx, db.AddReviewerToPRParams{PrID: prID, UserID: c.User.ID, TeamID: c.SourceTeam}); err != nil {
+			return nil, err
+		}
+		reason, inputs := sel.rationale(c)
+		if err := recordAssignment(ctx, q, prID, c, reason, inputs); err != nil {
+			return nil, err
+		}
+		assigned = append(assigned, c.User.ID.String())
+	}
+	return assigned, nil
+}
+
+// дополняет ответ сведениями о подборе: сколько требовалось, владельцы кода,
+// резервные команды, лимиты и невыполненные правила состава
+func (sel *reviewerSelection) annotate(d *PRDetails) {
+	d.RequestedReviewers = sel.requested
+	d.MissingReviewers = sel.requested - len(sel.reviewers)
+	for _, c := range sel.owners {
+		d.OwnerReviewers = append(d.OwnerReviewers, c.User.ID.String())
+	}
+	d.FallbackReviewers = sel.fallbackReviewerIDs()
+	d.CapacityLimited = sel.capacityLimited
+	d.RelaxedRules = sel.relaxed
+}
+
+// как попал на PR выбранный ревьювер c и на основе каких данных
+func (sel *reviewerSelection) rationale(c Candidate) (assignmentReason, *AssignmentInputs) {
+	a := assignmentReason{reason: AssignedInitial, strategy: sel.strategyName, required: sel.required, pairs: sel.pairs}
+	switch {
+	case slices.ContainsFunc(sel.owners, func(o Candidate) bool { return o.User.ID == c.User.ID }):
+		a.reason = AssignedOwner
+	case sel.fromFallback[c.User.ID]:
+		a.reason = AssignedFallback
+	}
+	inputs := a.inputs(c)
+	inputs.FromFallback = sel.fromFallback[c.User.ID]
+	return a, inputs
+}
+
+// id выбранных ревьюверов, взятых из резервных команд
+func (sel *reviewerSelection) fallbackReviewerIDs() []string {
+	var ids []string
+	for _, c := range sel.reviewers {
+		if sel.fromFallback[c.User.ID] {
+			ids = append(ids, c.User.ID.String())
+		}
+	}
+	return ids
+}
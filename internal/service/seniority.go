@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+)
+
+// уровни ревьюверов, как они хранятся в users.seniority
+const (
+	SeniorityJunior = "junior"
+	SeniorityMiddle = "middle"
+	SenioritySenior = "senior"
+)
+
+// правила команды о составе ревьюверов; названия попадают в relaxed_rules ответа
+const (
+	RuleRequireSenior   = "require_senior"
+	RuleJuniorsNotAlone = "juniors_not_alone"
+)
+
+// задаёт уровень пользователя
+func (s *Service) SetUserSeniority(ctx context.Context, userID uuid.UUID, seniority string) (*UserDetails, error) {
+	if seniority != SeniorityJunior && seniority != SeniorityMiddle && seniority != SenioritySenior {
+		return nil, fmt.Errorf("INVALID_SENIORITY: unknown seniority %q", seniority)
+	}
+
+	user, err := s.store.SetUserSeniority(ctx, db.SetUserSeniorityParams{ID: userID, Seniority: seniority})
+	if err != nil {
+		return nil, err
+	}
+
+	details := &UserDetails{User: user}
+	if user.TeamID.Valid {
+		if team, err := s.store.GetTeam(ctx, user.TeamID.Bytes); err == nil {
+			details.TeamName = team.Name
+		}
+	}
+	return details, nil
+}
+
+// требование к ревьюверу, без которого нарушается правило rule
+type seniorityRequirement struct {
+	rule string
+	ok   func(Candidate) bool
+}
+
+type seniorityRules struct {
+	requireSenior   bool
+	juniorsNotAlone bool
+}
+
+func seniorityRulesOf(team db.Team) seniorityRules {
+	return seniorityRules{requireSenior: team.RequireSenior, juniorsNotAlone: team.JuniorsNotAlone}
+}
+
+func isSenior(c Candidate) bool { return c.User.Seniority == SenioritySenior }
+
+func notJunior(c Candidate) bool { return c.User.Seniority != SeniorityJunior }
+
+// чего не хватает набору ревьюверов reviewers, чтобы правила выполнялись
+func (r seniorityRules) requirements(reviewers []Candidate) []seniorityRequirement {
+	var reqs []seniorityRequirement
+	if r.requireSenior && !slices.ContainsFunc(reviewers, isSenior) {
+		reqs = append(reqs, seniorityRequirement{rule: RuleRequireSenior, ok: isSenior})
+	}
+	if r.juniorsNotAlone && !slices.ContainsFunc(reviewers, notJunior) {
+		reqs = append(reqs, seniorityRequirement{rule: RuleJuniorsNotAlone, ok: notJunior})
+	}
+	return reqs
+}
+
+// доводит выбор до правил команды. Недостающего ревьювера добавляет из reserve, если до n
+// есть место, иначе ставит на место последнего выбранного после первых fixed (их не трогаем).
+// Возвращает итоговый выбор и правила, которые он нарушает.
+func (r seniorityRules) apply(rng *rand.Rand, strategy AssignmentStrategy, picked []Candidate, fixed, n int, reserve []Candidate) ([]Candidate, []string) {
+	picked = slices.Clone(picked)
+	if n <= 0 {
+		return picked, nil
+	}
+	for _, req := range r.requirements(picked) {
+		// добавленный ради первого правила senior закрывает и второе
+		if slices.ContainsFunc(picked, req.ok) {
+			continue
+		}
+		available := make([]Candidate, 0, len(reserve))
+		for _, c := range reserve {
+			if req.ok(c) && !slices.ContainsFunc(picked, func(p Candidate) bool { return p.User.ID == c.User.ID }) {
+				available = append(available, c)
+			}
+		}
+		choice := strategy.Pick(rng, available, 1)
+		slot := len(picked)
+		if len(picked) >= n {
+			slot = -1
+			for i := len(picked) - 1; i >= fixed; i-- {
+				if !req.ok(picked[i]) {
+					slot = i
+					break
+				}
+			}
+		}
+		switch {
+		case len(choice) == 0 || slot < 0:
+			// заменить некем - правило останется в unmet
+		case slot == len(picked):
+			picked = append(picked, choice[0])
+		default:
+			picked[slot] = choice[0]
+		}
+	}
+	return picked, r.unmet(picked)
+}
+
+// кандидаты, с которыми выполняется больше правил: по каждому требованию оставляем тех,
+// кто ему отвечает, если такие есть
+func satisfying(candidates []Candidate, reqs []seniorityRequirement) []Candidate {
+	for _, r := range reqs {
+		if ok := slices.DeleteFunc(slices.Clone(candidates), func(c Candidate) bool { return !r.ok(c) }); len(ok) > 0 {
+			candidates = ok
+		}
+	}
+	return candidates
+}
+
+// оборачивает стратегию так, что она выбирает сначала среди тех, с кем правила выполняются
+func withRules(base AssignmentStrategy, reqs []seniorityRequirement) AssignmentStrategy {
+	if len(reqs) == 0 {
+		return base
+	}
+	return ruleFirstStrategy{base: base, reqs: reqs}
+}
+
+type ruleFirstStrategy struct {
+	base AssignmentStrategy
+	reqs []seniorityRequirement
+}
+
+func (r ruleFirstStrategy) Pick(rng *rand.Rand, candidates []Candidate, n int) []Candidate {
+	return r.base.Pick(rng, satisfying(candidates, r.reqs), n)
+}
+
+// правила, которые нарушает итоговый набор ревьюверов reviewers. Без ревьюверов junior
+// не остаётся один, так что juniors_not_alone выполнено
+func (r seniorityRules) unmet(reviewers []Candidate) []string {
+	var rules []string
+	if r.requireSenior && !slices.ContainsFunc(reviewers, isSenior) {
+		rules = append(rules, RuleRequireSenior)
+	}
+	if r.juniorsNotAlone && len(reviewers) > 0 && !slices.ContainsFunc(reviewers, notJunior) {
+		rules = append(rules, RuleJuniorsNotAlone)
+	}
+	return rules
+}
+
+// текущие ревьюверы PR как кандидаты: ids[i] имеет уровень seniorities[i]
+func reviewerCandidates(ids []uuid.UUID, seniorities []string) []Candidate {
+	out := make([]Candidate, len(ids))
+	for i, id := range ids {
+		out[i] = Candidate{User: db.User{ID: id, Seniority: seniorities[i]}}
+	}
+	return out
+}
+
+// кандидаты из пользователей (для проверки правил по уже назначенным ревьюверам)
+func usersAsCandidates(users []db.User) []Candidate {
+	out := make([]Candidate, len(users))
+	for i, u := range users {
+		out[i] = Candidate{User: u}
+	}
+	return out
+}
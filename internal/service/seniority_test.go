@@ -0,0 +1,168 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func withSeniority(c Candidate, seniority string) Candidate {
+	c.User.Seniority = seniority
+	return c
+}
+
+func TestSeniorityRulesApply(t *testing.T) {
+	junior := withSeniority(candidate("junior", 0), SeniorityJunior)
+	junior2 := withSeniority(candidate("junior2", 0), SeniorityJunior)
+	middle := withSeniority(candidate("middle", 0), SeniorityMiddle)
+	senior := withSeniority(candidate("senior", 0), SenioritySenior)
+
+	both := seniorityRules{requireSenior: true, juniorsNotAlone: true}
+	tests := []struct {
+		name        string
+		rules       seniorityRules
+		picked      []Candidate
+		fixed, n    int
+		reserve     []Candidate
+		want        []string
+		wantRelaxed []string
+	}{
+		{
+			name:    "senior replaces the last non-senior",
+			rules:   seniorityRules{requireSenior: true},
+			picked:  []Candidate{junior, middle},
+			n:       2,
+			reserve: []Candidate{senior},
+			want:    []string{"junior", "senior"},
+		},
+		{
+			name:    "senior added while there is room",
+			rules:   seniorityRules{requireSenior: true},
+			picked:  []Candidate{junior},
+			n:       2,
+			reserve: []Candidate{senior},
+			want:    []string{"junior", "senior"},
+		},
+		{
+			name:        "no senior available",
+			rules:       seniorityRules{requireSenior: true},
+			picked:      []Candidate{junior, middle},
+			n:           2,
+			reserve:     []Candidate{junior2},
+			want:        []string{"junior", "middle"},
+			wantRelaxed: []string{RuleRequireSenior},
+		},
+		{
+			name:    "lone junior gets company",
+			rules:   seniorityRules{juniorsNotAlone: true},
+			picked:  []Candidate{junior},
+			n:       1,
+			reserve: []Candidate{junior2, middle},
+			want:    []string{"middle"},
+		},
+		{
+			name:        "fixed reviewers are not replaced",
+			rules:       seniorityRules{juniorsNotAlone: true},
+			picked:      []Candidate{junior},
+			fixed:       1,
+			n:           1,
+			reserve:     []Candidate{middle},
+			want:        []string{"junior"},
+			wantRelaxed: []string{RuleJuniorsNotAlone},
+		},
+		{
+			name:    "one senior satisfies both rules",
+			rules:   both,
+			picked:  []Candidate{junior, junior2},
+			n:       2,
+			reserve: []Candidate{senior},
+			want:    []string{"junior", "senior"},
+		},
+		{
+			name:        "middle covers juniors when no senior",
+			rules:       both,
+			picked:      []Candidate{junior, junior2},
+			n:           2,
+			reserve:     []Candidate{middle},
+			want:        []string{"junior", "middle"},
+			wantRelaxed: []string{RuleRequireSenior},
+		},
+		{
+			name:        "nobody to assign",
+			rules:       both,
+			n:           2,
+			want:        []string{},
+			wantRelaxed: []string{RuleRequireSenior},
+		},
+		{
+			name:   "rules already met",
+			rules:  both,
+			picked: []Candidate{senior, junior},
+			n:      2,
+			want:   []string{"senior", "junior"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, relaxed := tt.rules.apply(seededRand(1), leastLoadedStrategy{}, tt.picked, tt.fixed, tt.n, tt.reserve)
+			if !slices.Equal(names(got), tt.want) {
+				t.Errorf("apply() picked %v, want %v", names(got), tt.want)
+			}
+			if !slices.Equal(relaxed, tt.wantRelaxed) {
+				t.Errorf("apply() relaxed %v, want %v", relaxed, tt.wantRelaxed)
+			}
+		})
+	}
+}
+
+func TestSeniorityRulesUnmet(t *testing.T) {
+	junior := withSeniority(candidate("junior", 0), SeniorityJunior)
+	middle := withSeniority(candidate("middle", 0), SeniorityMiddle)
+	senior := withSeniority(candidate("senior", 0), SenioritySenior)
+
+	both := seniorityRules{requireSenior: true, juniorsNotAlone: true}
+	tests := []struct {
+		name      string
+		rules     seniorityRules
+		reviewers []Candidate
+		want      []string
+	}{
+		{name: "no rules", rules: seniorityRules{}, reviewers: []Candidate{junior}},
+		{name: "senior present", rules: both, reviewers: []Candidate{junior, senior}},
+		{name: "middle keeps junior company", rules: both, reviewers: []Candidate{junior, middle}, want: []string{RuleRequireSenior}},
+		{name: "only juniors", rules: both, reviewers: []Candidate{junior}, want: []string{RuleRequireSenior, RuleJuniorsNotAlone}},
+		{name: "no reviewers", rules: both, want: []string{RuleRequireSenior}},
+		{name: "no reviewers, juniors rule only", rules: seniorityRules{juniorsNotAlone: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.unmet(tt.reviewers); !slices.Equal(got, tt.want) {
+				t.Errorf("unmet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// замена берётся из тех, с кем выполняется больше правил
+func TestSatisfying(t *testing.T) {
+	junior := withSeniority(candidate("junior", 0), SeniorityJunior)
+	middle := withSeniority(candidate("middle", 0), SeniorityMiddle)
+	senior := withSeniority(candidate("senior", 0), SenioritySenior)
+
+	reqs := seniorityRules{requireSenior: true, juniorsNotAlone: true}.requirements([]Candidate{junior})
+	tests := []struct {
+		name       string
+		candidates []Candidate
+		want       []string
+	}{
+		{name: "senior preferred", candidates: []Candidate{junior, middle, senior}, want: []string{"senior"}},
+		{name: "middle when no senior", candidates: []Candidate{junior, middle}, want: []string{"middle"}},
+		{name: "everyone when nobody fits", candidates: []Candidate{junior}, want: []string{"junior"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(satisfying(tt.candidates, reqs)); !slices.Equal(got, tt.want) {
+				t.Errorf("satisfying() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,52 +4,134 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Narotan/pr-reviewer-service/internal/db"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Store interface {
 	CreateTeam(ctx context.Context, name string) (db.Team, error)
 	GetTeamByName(ctx context.Context, name string) (db.Team, error)
-	GetUsersByTeamID(ctx context.Context, teamID pgtype.UUID) ([]db.User, error)
+	GetTeamMembers(ctx context.Context, teamID uuid.UUID) ([]db.GetTeamMembersRow, error)
+	AddTeamMember(ctx context.Context, arg db.AddTeamMemberParams) error
 	CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error)
 	UpsertUser(ctx context.Context, arg db.UpsertUserParams) (db.User, error)
 	GetUser(ctx context.Context, id uuid.UUID) (db.User, error)
 	GetTeam(ctx context.Context, id uuid.UUID) (db.Team, error)
 	SetUserActive(ctx context.Context, arg db.SetUserActiveParams) error
+	SetUserSkills(ctx context.Context, arg db.SetUserSkillsParams) (db.User, error)
+	SetUserMaxOpenReviews(ctx context.Context, arg db.SetUserMaxOpenReviewsParams) (db.User, error)
+	SetUserSeniority(ctx context.Context, arg db.SetUserSeniorityParams) (db.User, error)
+	CreateAbsence(ctx context.Context, arg db.CreateAbsenceParams) (db.UserAbsence, error)
+	GetAbsencesForUser(ctx context.Context, userID uuid.UUID) ([]db.UserAbsence, error)
+	DeleteAbsence(ctx context.Context, id uuid.UUID) (int64, error)
 	CreatePullRequest(ctx context.Context, arg db.CreatePullRequestParams) (db.PullRequest, error)
 	CreatePullRequestWithID(ctx context.Context, arg db.CreatePullRequestWithIDParams) (db.PullRequest, error)
 	UpdatePullRequestStatus(ctx context.Context, arg db.UpdatePullRequestStatusParams) (db.PullRequest, error)
 	GetPullRequest(ctx context.Context, id uuid.UUID) (db.PullRequest, error)
 	GetOpenPullRequestsForReviewer(ctx context.Context, userID uuid.UUID) ([]db.PullRequest, error)
+	GetPendingPullRequestsForReviewer(ctx context.Context, userID uuid.UUID) ([]db.PullRequest, error)
+	GetReviewVerdicts(ctx context.Context, prID uuid.UUID) ([]db.GetReviewVerdictsRow, error)
 	AddReviewerToPR(ctx context.Context, arg db.AddReviewerToPRParams) error
 	RemoveReviewerFromPR(ctx context.Context, arg db.RemoveReviewerFromPRParams) error
 	GetReviewersForPR(ctx context.Context, prID uuid.UUID) ([]db.User, error)
-	GetCandidatesForInitialReview(ctx context.Context, authorID uuid.UUID) ([]db.User, error)
-	GetCandidatesForReassignment(ctx context.Context, arg db.GetCandidatesForReassignmentParams) ([]db.User, error)
+	GetCandidatesForInitialReview(ctx context.Context, arg db.GetCandidatesForInitialReviewParams) ([]db.GetCandidatesForInitialReviewRow, error)
+	GetCandidatesForReassignment(ctx context.Context, arg db.GetCandidatesForReassignmentParams) ([]db.GetCandidatesForReassignmentRow, error)
+	UpdateTeamSettings(ctx context.Context, arg db.UpdateTeamSettingsParams) (db.Team, error)
 	// выполняет fn в транзакции; fn получает объект запросов, привязанный к tx
 	ExecTx(ctx context.Context, fn func(q *db.Queries) error) error
 	// статистика назначений (sqlc сгенерирует методы GetAssignmentCountsByUser/GetAssignmentCountsByPR)
 	GetAssignmentCountsByUser(ctx context.Context) ([]db.GetAssignmentCountsByUserRow, error)
 	GetAssignmentCountsByPR(ctx context.Context) ([]db.GetAssignmentCountsByPRRow, error)
+	GetTeamFallbacks(ctx context.Context, teamID uuid.UUID) ([]db.Team, error)
+	GetChildTeams(ctx context.Context, parentID pgtype.UUID) ([]db.Team, error)
+	GetUnderstaffedPullRequests(ctx context.Context, arg db.GetUnderstaffedPullRequestsParams) ([]db.GetUnderstaffedPullRequestsRow, error)
+	GetPairCountsByTeam(ctx context.Context, since pgtype.Timestamptz) ([]db.GetPairCountsByTeamRow, error)
+	GetAssignmentsForPR(ctx context.Context, prID uuid.UUID) ([]db.GetAssignmentsForPRRow, error)
+	GetPREvents(ctx context.Context, prID uuid.UUID) ([]db.PrEvent, error)
 }
 
 type UserDetails struct {
 	User     db.User
 	TeamName string
+	// не входят в json пользователя: результат переназначения его OPEN ревью при деактивации
+	Reassigned    []Reassignment `json:"-"`
+	NotReassigned []Reassignment `json:"-"`
+	// ревьюверы, добранные на PR после повторной активации
+	ToppedUp []TopUp `json:"-"`
 }
 
 type TeamMemberDetails struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
 	IsActive bool   `json:"is_active"`
+	// роль в этой команде; пользователь может состоять в нескольких командах
+	Role string `json:"role,omitempty"`
 }
 
 type TeamDetails struct {
 	TeamName string              `json:"team_name"`
 	Members  []TeamMemberDetails `json:"members"`
+	// родительская команда (отдел) и, по запросу, все подкоманды
+	ParentTeam string        `json:"parent_team,omitempty"`
+	SubTeams   []TeamDetails `json:"sub_teams,omitempty"`
+	// ревьюверы, добранные на PR благодаря новым участникам
+	ToppedUp []TopUp `json:"topped_up,omitempty"`
+}
+
+// настройки команды, влияющие на назначение ревьюверов
+type TeamSettings struct {
+	TeamName           string `json:"team_name"`
+	AssignmentStrategy string `json:"assignment_strategy"`
+	ReviewersCount     int    `json:"reviewers_count"`
+	// лимит открытых ревью по умолчанию для участников; null - без ограничения
+	MaxOpenReviews *int `json:"max_open_reviews"`
+	// правила состава ревьюверов: нужен senior; junior не ревьювит без не-junior
+	RequireSenior   bool `json:"require_senior"`
+	JuniorsNotAlone bool `json:"juniors_not_alone"`
+	// политика слияния: минимум одобрений; CHANGES_REQUESTED блокирует слияние
+	MinApprovals            int  `json:"min_approvals"`
+	BlockOnChangesRequested bool `json:"block_on_changes_requested"`
+	// резервные команды в порядке приоритета
+	FallbackTeams []string `json:"fallback_teams"`
+}
+
+// изменение настроек команды; nil означает "не менять"
+type TeamSettingsUpdate struct {
+	AssignmentStrategy *string
+	ReviewersCount     *int
+	// 0 снимает лимит команды
+	MaxOpenReviews  *int
+	RequireSenior   *bool
+	JuniorsNotAlone *bool
+	// 0 снимает требование одобрений
+	MinApprovals            *int
+	BlockOnChangesRequested *bool
+	// заменяет весь список резервных команд; пустой список очищает его
+	FallbackTeams *[]string
+}
+
+// необязательные параметры создания PR
+type CreatePROptions struct {
+	// переопределяет reviewers_count команды автора
+	ReviewersCount *int
+	// изменённые файлы: их владельцы (CODEOWNERS) назначаются в первую очередь
+	ChangedFiles []string
+	// репозиторий, чей набор правил владения использовать вместо набора команды
+	Repository string
+	// навыки, нужные для ревью: кандидаты с большим совпадением выбираются первыми
+	RequiredSkills []string
+	// команда автора, по которой подбирать ревьюверов; пусто - основная команда автора
+	TeamName string
+	// создать черновик: ревьюверы назначаются, когда он будет отмечен готовым
+	Draft bool
 }
 
 type PRDetails struct {
@@ -58,9 +140,40 @@ type PRDetails struct {
 	AuthorID          string   `json:"author_id"`
 	Status            string   `json:"status"`
 	AssignedReviewers []string `json:"assigned_reviewers"`
+	RequiredSkills    []string `json:"required_skills,omitempty"`
 	CreatedAt         *string  `json:"createdAt,omitempty"`
-	MergedAt          *string  `json:"mergedAt,omitempty"`
-	ReplacedBy        string   `json:"-"` // не входит в json ответ, используется для переназначения
+	UpdatedAt         *string  `json:"updatedAt,omitempty"`
+	// время слияния; у не слитых PR не задаётся
+	MergedAt *string `json:"mergedAt,omitempty"`
+	// заполняются при создании: сколько ревьюверов требовалось и скольких не нашлось
+	RequestedReviewers int `json:"requested_reviewers,omitempty"`
+	MissingReviewers   int `json:"missing_reviewers,omitempty"`
+	// ревьюверы, назначенные как владельцы изменённых файлов
+	OwnerReviewers []string `json:"owner_reviewers,omitempty"`
+	// ревьюверы, взятые из резервных команд
+	FallbackReviewers []string `json:"fallback_reviewers,omitempty"`
+	// ревьюверов не хватило, потому что подходящие люди загружены до своего лимита
+	CapacityLimited bool `json:"capacity_limited,omitempty"`
+	// правила состава команды, которые не удалось выполнить (не нашлось подходящих людей)
+	RelaxedRules []string `json:"relaxed_rules,omitempty"`
+	// решения ревьюверов, которые уже высказались
+	Verdicts []ReviewVerdict `json:"verdicts,omitempty"`
+	// PR слит в обход политики слияния команды: кем и какие правила были нарушены
+	MergeForced     bool     `json:"merge_forced,omitempty"`
+	MergeForcedBy   string   `json:"merge_forced_by,omitempty"`
+	MergeViolations []string `json:"merge_violations,omitempty"`
+	// история назначений, только по запросу (include=rationale)
+	Rationale  []AssignmentRationale `json:"rationale,omitempty"`
+	ReplacedBy string                `json:"-"` // не входит в json ответ, используется для переназначения
+}
+
+// время в формате ответов API; nil, если значения нет
+func formatTime(ts pgtype.Timestamptz) *string {
+	if !ts.Valid {
+		return nil
+	}
+	formatted := ts.Time.Format("2006-01-02T15:04:05Z07:00")
+	return &formatted
 }
 
 type AssignmentStats struct {
@@ -68,21 +181,75 @@ type AssignmentStats struct {
 	PRs   []db.GetAssignmentCountsByPRRow   `json:"prs"`
 }
 
+// максимум ревьюверов на PR, если не задан опцией WithMaxReviewers
+const DefaultMaxReviewers = 5
+
 type Service struct {
-	store Store
+	store        Store
+	maxReviewers int
+	// источник случайности для всех решений о назначении
+	rng *rand.Rand
+	// за какой период недавние пары автор -> ревьювер понижают приоритет кандидата
+	pairingWindow time.Duration
+	// на сколько уровней вверх по дереву команд искать ревьюверов
+	escalationDepth int
+}
+
+// Option настраивает Service при создании
+type Option func(*Service)
+
+// ограничивает число ревьюверов на один PR
+func WithMaxReviewers(n int) Option {
+	return func(s *Service) {
+		if n > 0 {
+			s.maxReviewers = n
+		}
+	}
+}
+
+// задаёт источник случайности для выбора ревьюверов; с фиксированным seed
+// (например, rand.NewPCG(seed, seed)) все назначения воспроизводимы
+func WithRandSource(src rand.Source) Option {
+	return func(s *Service) {
+		if src != nil {
+			s.rng = rand.New(&lockedSource{src: src})
+		}
+	}
+}
+
+// rand.Source не безопасен для конкурентного использования, а сервис обслуживает
+// параллельные запросы
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (l *lockedSource) Uint64() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.src.Uint64()
 }
 
-func NewService(store Store) *Service {
-	return &Service{
-		store: store,
+func NewService(store Store, opts ...Option) *Service {
+	s := &Service{
+		store:           store,
+		maxReviewers:    DefaultMaxReviewers,
+		rng:             rand.New(&lockedSource{src: rand.NewPCG(rand.Uint64(), rand.Uint64())}),
+		pairingWindow:   DefaultPairingWindow,
+		escalationDepth: DefaultEscalationDepth,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *Service) CreateTeam(ctx context.Context, name string) (db.Team, error) {
 	return db.Team{}, errors.New("not implemented")
 }
 
-// создает команду с участниками
+// создает команду с участниками. Участники, уже состоящие в других командах, остаются в них:
+// их основная команда не меняется.
 func (s *Service) CreateTeamWithMembers(ctx context.Context, teamName string, members []TeamMemberDetails) (*TeamDetails, error) {
 	team, err := s.store.CreateTeam(ctx, teamName)
 	if err != nil {
@@ -104,27 +271,64 @@ func (s *Service) CreateTeamWithMembers(ctx context.Context, teamName string, me
 		_, err = s.store.UpsertUser(ctx, db.UpsertUserParams{
 			ID:       uid,
 			Name:     member.Username,
-			TeamID:   pgtype.UUID{Bytes: team.ID},
+			TeamID:   pgtype.UUID{Bytes: team.ID, Valid: true},
 			IsActive: member.IsActive,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to upsert user %s (%s) for team %s: %w", member.Username, member.UserID, teamName, err)
 		}
+		err = s.store.AddTeamMember(ctx, db.AddTeamMemberParams{
+			TeamID: team.ID,
+			UserID: uid,
+			Role:   pgtype.Text{String: member.Role, Valid: member.Role != ""},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add user %s to team %s: %w", member.UserID, teamName, err)
+		}
 
 		resultDetails.Members = append(resultDetails.Members, member)
 	}
 
+	// новые и вернувшиеся участники могут закрыть нехватку ревьюверов на OPEN PR команды
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		resultDetails.ToppedUp, err = s.topUpUnderstaffed(ctx, txq, topUpScope{teamIDs: []uuid.UUID{team.ID}})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return resultDetails, nil
 }
 
-// получает детали команды
-func (s *Service) GetTeamDetails(ctx context.Context, teamName string) (*TeamDetails, error) {
+// получает детали команды; с includeSubTeams - вместе со всеми подкомандами
+func (s *Service) GetTeamDetails(ctx context.Context, teamName string, includeSubTeams bool) (*TeamDetails, error) {
 	team, err := s.store.GetTeamByName(ctx, teamName)
 	if err != nil {
 		return nil, err
 	}
 
-	users, err := s.store.GetUsersByTeamID(ctx, pgtype.UUID{Bytes: team.ID})
+	details, err := s.teamDetails(ctx, team)
+	if err != nil {
+		return nil, err
+	}
+	if team.ParentID.Valid {
+		parent, err := s.store.GetTeam(ctx, team.ParentID.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		details.ParentTeam = parent.Name
+	}
+	if includeSubTeams {
+		if details.SubTeams, err = s.subTeams(ctx, team.ID); err != nil {
+			return nil, err
+		}
+	}
+	return details, nil
+}
+
+func (s *Service) teamDetails(ctx context.Context, team db.Team) (*TeamDetails, error) {
+	users, err := s.store.GetTeamMembers(ctx, team.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -135,37 +339,230 @@ func (s *Service) GetTeamDetails(ctx context.Context, teamName string) (*TeamDet
 			UserID:   u.ID.String(),
 			Username: u.Name,
 			IsActive: u.IsActive,
+			Role:     u.Role.String,
 		})
 	}
 
 	return &TeamDetails{TeamName: team.Name, Members: members}, nil
 }
 
-// устанавливает статус активности пользователя
-func (s *Service) SetUserActiveStatus(ctx context.Context, userID uuid.UUID, isActive bool) (*UserDetails, error) {
-	if err := s.store.SetUserActive(ctx, db.SetUserActiveParams{ID: userID, IsActive: isActive}); err != nil {
+// получает настройки команды
+func (s *Service) GetTeamSettings(ctx context.Context, teamName string) (*TeamSettings, error) {
+	team, err := s.store.GetTeamByName(ctx, teamName)
+	if err != nil {
+		return nil, fmt.Errorf("NOT_FOUND: team not found")
+	}
+	fallbacks, err := s.store.GetTeamFallbacks(ctx, team.ID)
+	if err != nil {
 		return nil, err
 	}
+	return teamSettingsFromDB(team, fallbacks), nil
+}
 
-	user, err := s.store.GetUser(ctx, userID)
+// обновляет настройки команды
+func (s *Service) UpdateTeamSettings(ctx context.Context, teamName string, upd TeamSettingsUpdate) (*TeamSettings, error) {
+	params := db.UpdateTeamSettingsParams{}
+	if upd.AssignmentStrategy != nil {
+		if _, ok := StrategyByName(*upd.AssignmentStrategy); !ok {
+			return nil, fmt.Errorf("INVALID_STRATEGY: unknown assignment strategy %q", *upd.AssignmentStrategy)
+		}
+		params.AssignmentStrategy = pgtype.Text{String: *upd.AssignmentStrategy, Valid: true}
+	}
+	if upd.ReviewersCount != nil {
+		if err := s.validateReviewersCount(*upd.ReviewersCount); err != nil {
+			return nil, err
+		}
+		params.ReviewersCount = pgtype.Int4{Int32: int32(*upd.ReviewersCount), Valid: true}
+	}
+	if upd.MaxOpenReviews != nil {
+		if *upd.MaxOpenReviews < 0 {
+			return nil, fmt.Errorf("INVALID_MAX_OPEN_REVIEWS: max_open_reviews must not be negative")
+		}
+		params.SetMaxOpenReviews = true
+		if *upd.MaxOpenReviews > 0 {
+			params.MaxOpenReviews = pgtype.Int4{Int32: int32(*upd.MaxOpenReviews), Valid: true}
+		}
+	}
+
+	if upd.RequireSenior != nil {
+		params.RequireSenior = pgtype.Bool{Bool: *upd.RequireSenior, Valid: true}
+	}
+	if upd.JuniorsNotAlone != nil {
+		params.JuniorsNotAlone = pgtype.Bool{Bool: *upd.JuniorsNotAlone, Valid: true}
+	}
+	if upd.MinApprovals != nil {
+		if *upd.MinApprovals < 0 {
+			return nil, fmt.Errorf("INVALID_MIN_APPROVALS: min_approvals must not be negative")
+		}
+		params.MinApprovals = pgtype.Int4{Int32: int32(*upd.MinApprovals), Valid: true}
+	}
+	if upd.BlockOnChangesRequested != nil {
+		params.BlockOnChangesRequested = pgtype.Bool{Bool: *upd.BlockOnChangesRequested, Valid: true}
+	}
+
+	var settings *TeamSettings
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		team, err := txq.GetTeamByName(ctx, teamName)
+		if err != nil {
+			return fmt.Errorf("NOT_FOUND: team not found")
+		}
+		params.ID = team.ID
+
+		updated, err := txq.UpdateTeamSettings(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		if upd.FallbackTeams != nil {
+			if err := txq.DeleteTeamFallbacks(ctx, team.ID); err != nil {
+				return err
+			}
+			seen := map[uuid.UUID]bool{team.ID: true}
+			for i, name := range *upd.FallbackTeams {
+				fb, err := txq.GetTeamByName(ctx, name)
+				if err != nil {
+					return fmt.Errorf("FALLBACK_NOT_FOUND: fallback team %s not found", name)
+				}
+				if seen[fb.ID] {
+					return fmt.Errorf("INVALID_FALLBACK: fallback team %s is the team itself or listed twice", name)
+				}
+				seen[fb.ID] = true
+				if err := txq.AddTeamFallback(ctx, db.AddTeamFallbackParams{
+					TeamID:         team.ID,
+					FallbackTeamID: fb.ID,
+					Priority:       int32(i),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+
+		fallbacks, err := txq.GetTeamFallbacks(ctx, team.ID)
+		if err != nil {
+			return err
+		}
+		settings = teamSettingsFromDB(updated, fallbacks)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return settings, nil
+}
 
-	team, err := s.store.GetTeam(ctx, user.TeamID.Bytes)
+func teamSettingsFromDB(team db.Team, fallbacks []db.Team) *TeamSettings {
+	strategy := DefaultStrategy
+	if team.AssignmentStrategy.Valid {
+		strategy = team.AssignmentStrategy.String
+	}
+	names := make([]string, len(fallbacks))
+	for i, fb := range fallbacks {
+		names[i] = fb.Name
+	}
+	settings := &TeamSettings{
+		TeamName:                team.Name,
+		AssignmentStrategy:      strategy,
+		ReviewersCount:          int(team.ReviewersCount),
+		RequireSenior:           team.RequireSenior,
+		JuniorsNotAlone:         team.JuniorsNotAlone,
+		MinApprovals:            int(team.MinApprovals),
+		BlockOnChangesRequested: team.BlockOnChangesRequested,
+		FallbackTeams:           names,
+	}
+	if team.MaxOpenReviews.Valid {
+		limit := int(team.MaxOpenReviews.Int32)
+		settings.MaxOpenReviews = &limit
+	}
+	return settings
+}
+
+func (s *Service) validateReviewersCount(n int) error {
+	if n < 0 || n > s.maxReviewers {
+		return fmt.Errorf("INVALID_REVIEWERS_COUNT: reviewers_count must be between 0 and %d", s.maxReviewers)
+	}
+	return nil
+}
+
+// возвращает стратегию для замены ревьювера: явно выбранную стратегию команды,
+// а если команда её не задавала - равновероятный выбор среди всех подходящих
+func reassignmentStrategy(ctx context.Context, q *db.Queries, teamID pgtype.UUID) (AssignmentStrategy, string, error) {
+	if !teamID.Valid {
+		return randomStrategy{}, StrategyRandom, nil
+	}
+	team, err := q.GetTeam(ctx, teamID.Bytes)
 	if err != nil {
-		return &UserDetails{User: user, TeamName: ""}, nil
+		return nil, "", err
+	}
+	if !team.AssignmentStrategy.Valid {
+		return randomStrategy{}, StrategyRandom, nil
+	}
+	return strategyOf(team), strategyNameOf(team), nil
+}
+
+func strategyOf(team db.Team) AssignmentStrategy {
+	if team.AssignmentStrategy.Valid {
+		if st, ok := StrategyByName(team.AssignmentStrategy.String); ok {
+			return st
+		}
 	}
+	st, _ := StrategyByName(DefaultStrategy)
+	return st
+}
+
+// устанавливает статус активности пользователя.
+// При деактивации с reassign=true пользователь в той же транзакции заменяется на всех
+// OPEN PR по правилам ReassignReviewer; PR без замены остаются с меньшим числом ревьюверов.
+func (s *Service) SetUserActiveStatus(ctx context.Context, userID uuid.UUID, isActive bool, reassign bool) (*UserDetails, error) {
+	details := &UserDetails{}
+	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		if err := txq.SetUserActive(ctx, db.SetUserActiveParams{ID: userID, IsActive: isActive}); err != nil {
+			return err
+		}
+
+		user, err := txq.GetUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		details.User = user
+
+		var team db.Team
+		if user.TeamID.Valid {
+			if team, err = txq.GetTeam(ctx, user.TeamID.Bytes); err != nil {
+				return err
+			}
+			details.TeamName = team.Name
+		}
 
-	return &UserDetails{User: user, TeamName: team.Name}, nil
+		if isActive {
+			teamIDs, err := usersTeams(ctx, txq, []uuid.UUID{userID})
+			if err != nil {
+				return err
+			}
+			details.ToppedUp, err = s.topUpUnderstaffed(ctx, txq, topUpScope{teamIDs: teamIDs})
+			return err
+		}
+		if !reassign {
+			return nil
+		}
+		details.Reassigned, details.NotReassigned, err = s.replaceReviewers(ctx, txq, team, []uuid.UUID{userID})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
 }
 
 // создает pull request
-func (s *Service) CreatePullRequest(ctx context.Context, prID, title, authorIDStr string) (*PRDetails, error) {
-	// все операции создания PR и назначения ревьюверов выполняются в транзакции
-	var createdPR db.PullRequest
-	var assigned []string
+func (s *Service) CreatePullRequest(ctx context.Context, prID, title, authorIDStr string, opts CreatePROptions) (*PRDetails, error) {
+	if opts.ReviewersCount != nil {
+		if err := s.validateReviewersCount(*opts.ReviewersCount); err != nil {
+			return nil, err
+		}
+	}
 
+	// все операции создания PR и назначения ревьюверов выполняются в транзакции
+	var details *PRDetails
 	err := s.store.ExecTx(ctx, func(txq *db.Queries) error {
 		// парсим id
 		prUUID, err := uuid.Parse(prID)
@@ -183,117 +580,158 @@ func (s *Service) CreatePullRequest(ctx context.Context, prID, title, authorIDSt
 		}
 
 		// проверяем автора
-		if _, err := txq.GetUser(ctx, authorID); err != nil {
+		author, err := txq.GetUser(ctx, authorID)
+		if err != nil {
 			return fmt.Errorf("author not found")
 		}
 
-		// создаём PR с указанным id
-		pr, err := txq.CreatePullRequestWithID(ctx, db.CreatePullRequestWithIDParams{ID: prUUID, Title: title, AuthorID: authorID})
+		// подбираем ревьюверов стратегией команды PR; черновику - только команду и их число
+		status := StatusOpen
+		var sel *reviewerSelection
+		if opts.Draft {
+			status = StatusDraft
+			sel, err = s.draftSelection(ctx, txq, author, opts)
+		} else {
+			sel, err = s.selectReviewers(ctx, txq, author, opts)
+		}
 		if err != nil {
 			return err
 		}
-		createdPR = pr
+		var teamID pgtype.UUID
+		if sel.hasTeam {
+			teamID = pgtype.UUID{Bytes: sel.team.ID, Valid: true}
+		}
 
-		// выбираем кандидатов и добавляем как ревьюверов (до 2)
-		candidates, err := txq.GetCandidatesForInitialReview(ctx, authorID)
+		// создаём PR с указанным id; нехватку ревьюверов потом доберёт topUpUnderstaffed
+		pr, err := txq.CreatePullRequestWithID(ctx, db.CreatePullRequestWithIDParams{
+			ID:              prUUID,
+			Title:           title,
+			AuthorID:        authorID,
+			RequiredSkills:  normalizeSkills(opts.RequiredSkills),
+			TargetReviewers: int32(sel.requested),
+			TeamID:          teamID,
+			Status:          status,
+		})
 		if err != nil {
-			// если нет кандидатов, продолжаем без ошибок
-			candidates = []db.User{}
+			return err
 		}
-		for i := range candidates {
-			if i >= 2 {
-				break
-			}
-			if err := txq.AddReviewerToPR(ctx, db.AddReviewerToPRParams{PrID: pr.ID, UserID: candidates[i].ID}); err != nil {
-				return err
-			}
-			assigned = append(assigned, candidates[i].ID.String())
+		if err := recordEvent(ctx, txq, pr.ID, prEvent{typ: EventCreated, to: pr.Status}); err != nil {
+			return err
+		}
+
+		assigned, err := assignSelected(ctx, txq, pr.ID, sel)
+		if err != nil {
+			return err
+		}
+		details = &PRDetails{
+			PullRequestID:     pr.ID.String(),
+			PullRequestName:   pr.Title,
+			AuthorID:          pr.AuthorID.String(),
+			Status:            pr.Status,
+			AssignedReviewers: assigned,
+			RequiredSkills:    pr.RequiredSkills,
+			CreatedAt:         formatTime(pr.CreatedAt),
+			UpdatedAt:         formatTime(pr.UpdatedAt),
+		}
+		if opts.Draft {
+			details.RequestedReviewers = sel.requested
+		} else {
+			sel.annotate(details)
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-
-	createdAt := createdPR.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00")
-	return &PRDetails{
-		PullRequestID:     createdPR.ID.String(),
-		PullRequestName:   createdPR.Title,
-		AuthorID:          createdPR.AuthorID.String(),
-		Status:            createdPR.Status,
-		AssignedReviewers: assigned,
-		CreatedAt:         &createdAt,
-	}, nil
+	return details, nil
 }
 
-// обновляет статус pr на merged
-func (s *Service) UpdatePRStatusToMerged(ctx context.Context, prIDStr string) (*PRDetails, error) {
+// обновляет статус pr на merged. Слияние проверяется политикой команды PR; force сливает
+// в обход неё (только admin команды PR), и это отмечается в PR. Уже слитый PR возвращается без изменений.
+func (s *Service) UpdatePRStatusToMerged(ctx context.Context, prIDStr string, force bool) (*PRDetails, error) {
 	prID, err := uuid.Parse(prIDStr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid pull_request_id format: %w", err)
 	}
 
-	existingPR, err := s.store.GetPullRequest(ctx, prID)
-	if err != nil {
-		return nil, fmt.Errorf("PR not found")
-	}
-
-	if existingPR.Status == "MERGED" {
-		reviewers, _ := s.store.GetReviewersForPR(ctx, prID)
-		reviewerIDs := make([]string, len(reviewers))
-		for i, r := range reviewers {
-			reviewerIDs[i] = r.ID.String()
+	var details *PRDetails
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		// статус и политику проверяем по строке, заблокированной в этой транзакции
+		locked, err := txq.GetPullRequestForUpdate(ctx, prID)
+		if err != nil {
+			return fmt.Errorf("PR not found")
 		}
-
-		createdAt := existingPR.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00")
-		mergedAt := existingPR.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00")
-
-		return &PRDetails{
-			PullRequestID:     existingPR.ID.String(),
-			PullRequestName:   existingPR.Title,
-			AuthorID:          existingPR.AuthorID.String(),
-			Status:            existingPR.Status,
-			AssignedReviewers: reviewerIDs,
-			CreatedAt:         &createdAt,
-			MergedAt:          &mergedAt,
-		}, nil
-	}
-
-	pr, err := s.store.UpdatePullRequestStatus(ctx, db.UpdatePullRequestStatusParams{ID: prID, Status: "MERGED"})
+		if locked.Status == StatusMerged {
+			details, err = loadPRDetails(ctx, txq, locked)
+			return err
+		}
+		if err := transitionMerge.check(locked.Status); err != nil {
+			return err
+		}
+		violations, err := mergePolicyViolations(ctx, txq, locked)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 && !force {
+			return fmt.Errorf("MERGE_BLOCKED: %s", strings.Join(violations, "; "))
+		}
+		if len(violations) > 0 {
+			allowed, err := canForceMerge(ctx, txq, locked)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				return fmt.Errorf("FORBIDDEN: only a team %s can force a merge", RoleAdmin)
+			}
+		}
+		merge := db.MergePullRequestParams{ID: prID, MergeViolations: []string{}}
+		if len(violations) > 0 {
+			merge.MergeForced = true
+			merge.MergeForcedBy = pgtype.UUID{Bytes: actorOf(ctx).id, Valid: true}
+			merge.MergeViolations = violations
+		}
+		pr, err := txq.MergePullRequest(ctx, merge)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("INVALID_TRANSITION: cannot merge PR in status %s", locked.Status)
+		}
+		if err != nil {
+			return err
+		}
+		if err := recordEvent(ctx, txq, prID, prEvent{
+			typ:     EventMerged,
+			from:    locked.Status,
+			to:      pr.Status,
+			details: mergeEventDetails{Forced: pr.MergeForced, Violations: pr.MergeViolations},
+		}); err != nil {
+			return err
+		}
+		details, err = loadPRDetails(ctx, txq, pr)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	reviewers, _ := s.store.GetReviewersForPR(ctx, prID)
-	reviewerIDs := make([]string, len(reviewers))
-	for i, r := range reviewers {
-		reviewerIDs[i] = r.ID.String()
-	}
-
-	createdAt := pr.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00")
-	mergedAt := pr.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00")
-
-	return &PRDetails{
-		PullRequestID:     pr.ID.String(),
-		PullRequestName:   pr.Title,
-		AuthorID:          pr.AuthorID.String(),
-		Status:            pr.Status,
-		AssignedReviewers: reviewerIDs,
-		CreatedAt:         &createdAt,
-		MergedAt:          &mergedAt,
-	}, nil
+	return details, nil
 }
 
 type PRShort struct {
-	PullRequestID   string `json:"pull_request_id"`
-	PullRequestName string `json:"pull_request_name"`
-	AuthorID        string `json:"author_id"`
-	Status          string `json:"status"`
+	PullRequestID   string  `json:"pull_request_id"`
+	PullRequestName string  `json:"pull_request_name"`
+	AuthorID        string  `json:"author_id"`
+	Status          string  `json:"status"`
+	CreatedAt       *string `json:"createdAt,omitempty"`
+	UpdatedAt       *string `json:"updatedAt,omitempty"`
+	MergedAt        *string `json:"mergedAt,omitempty"`
 }
 
-// получает открытые pr для ревьювера
-func (s *Service) GetOpenPRsForReviewer(ctx context.Context, userID uuid.UUID) ([]PRShort, error) {
-	prs, err := s.store.GetOpenPullRequestsForReviewer(ctx, userID)
+// получает открытые pr для ревьювера; pendingOnly оставляет только те, где от него
+// ещё ждут решения (нет вердикта или только комментарии)
+func (s *Service) GetOpenPRsForReviewer(ctx context.Context, userID uuid.UUID, pendingOnly bool) ([]PRShort, error) {
+	fetch := s.store.GetOpenPullRequestsForReviewer
+	if pendingOnly {
+		fetch = s.store.GetPendingPullRequestsForReviewer
+	}
+	prs, err := fetch(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -305,13 +743,17 @@ func (s *Service) GetOpenPRsForReviewer(ctx context.Context, userID uuid.UUID) (
 			PullRequestName: pr.Title,
 			AuthorID:        pr.AuthorID.String(),
 			Status:          pr.Status,
+			CreatedAt:       formatTime(pr.CreatedAt),
+			UpdatedAt:       formatTime(pr.UpdatedAt),
+			MergedAt:        formatTime(pr.MergedAt),
 		}
 	}
 	return result, nil
 }
 
-// переназначает ревьювера
-func (s *Service) ReassignReviewer(ctx context.Context, prIDStr string, oldReviewerIDStr string) (*PRDetails, error) {
+// переназначает ревьювера. Если newReviewerIDStr задан, назначается именно он - при условии,
+// что он подходит по тем же правилам, что и автоматическая замена; иначе замена выбирается сама.
+func (s *Service) ReassignReviewer(ctx context.Context, prIDStr string, oldReviewerIDStr string, newReviewerIDStr string) (*PRDetails, error) {
 	prID, err := uuid.Parse(prIDStr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid pull_request_id format: %w", err)
@@ -320,86 +762,199 @@ func (s *Service) ReassignReviewer(ctx context.Context, prIDStr string, oldRevie
 	if err != nil {
 		return nil, fmt.Errorf("invalid user_id format: %w", err)
 	}
-
-	pr, err := s.store.GetPullRequest(ctx, prID)
-	if err != nil {
-		return nil, fmt.Errorf("NOT_FOUND: PR not found")
+	var requestedID uuid.UUID
+	if newReviewerIDStr != "" {
+		if requestedID, err = uuid.Parse(newReviewerIDStr); err != nil {
+			return nil, fmt.Errorf("invalid new_user_id format: %w", err)
+		}
 	}
 
-	if pr.Status == "MERGED" {
-		return nil, fmt.Errorf("PR_MERGED: cannot reassign on merged PR")
-	}
+	var newReviewerID uuid.UUID
+	var fromFallback bool
+	var relaxed []string
+	var details *PRDetails
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		pr, err := editablePR(ctx, txq, prID)
+		if err != nil {
+			return err
+		}
+		reviewers, err := txq.GetReviewersForPR(ctx, prID)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(reviewers, func(u db.User) bool { return u.ID == oldReviewerID }) {
+			return fmt.Errorf("NOT_ASSIGNED: reviewer is not assigned to this PR")
+		}
 
-	reviewers, err := s.store.GetReviewersForPR(ctx, prID)
-	if err != nil {
-		return nil, err
-	}
+		oldReviewer, err := txq.GetUser(ctx, oldReviewerID)
+		if err != nil {
+			return err
+		}
+		// замену ищем в команде, через которую был назначен заменяемый
+		srcTeam, err := replacementTeam(ctx, txq, prID, oldReviewer)
+		if err != nil {
+			return err
+		}
+		var candidates []Candidate
+		if srcTeam.Valid {
+			rows, err := txq.GetCandidatesForReassignment(ctx, db.GetCandidatesForReassignmentParams{
+				TeamID: srcTeam.Bytes,
+				ID:     oldReviewerID,
+				PrID:   prID,
+			})
+			if err != nil {
+				return err
+			}
+			candidates = make([]Candidate, len(rows))
+			for i, r := range rows {
+				candidates[i] = reassignmentCandidate(r, srcTeam.Bytes)
+			}
+		}
 
-	isAssigned := false
-	for _, r := range reviewers {
-		if r.ID == oldReviewerID {
-			isAssigned = true
-			break
+		// правила состава команды PR проверяются по ревьюверам, которые остаются на PR
+		var rules seniorityRules
+		if pr.TeamID.Valid {
+			prTeam, err := txq.GetTeam(ctx, pr.TeamID.Bytes)
+			if err != nil {
+				return err
+			}
+			rules = seniorityRulesOf(prTeam)
 		}
-	}
+		remaining := slices.DeleteFunc(slices.Clone(reviewers), func(u db.User) bool { return u.ID == oldReviewerID })
+		reqs := rules.requirements(usersAsCandidates(remaining))
 
-	if !isAssigned {
-		return nil, fmt.Errorf("NOT_ASSIGNED: reviewer is not assigned to this PR")
-	}
+		var chosen Candidate
+		reason := assignmentReason{reason: AssignedReassignment, replaced: oldReviewerID, required: pr.RequiredSkills}
+		if requestedID != uuid.Nil {
+			if err := checkRequestedReviewer(ctx, txq, requestedID, oldReviewer, srcTeam, pr, candidates); err != nil {
+				return err
+			}
+			chosen = candidates[slices.IndexFunc(candidates, func(c Candidate) bool { return c.User.ID == requestedID })]
+		} else {
+			// замена выбирается стратегией команды заменяемого ревьювера с учётом навыков PR
+			// и истории пар; без стратегии команды - равновероятно
+			strategy, name, err := reassignmentStrategy(ctx, txq, srcTeam)
+			if err != nil {
+				return err
+			}
+			pairings, err := s.recentPairings(ctx, txq, []uuid.UUID{pr.AuthorID})
+			if err != nil {
+				return err
+			}
+			reason.strategy, reason.pairs = name, pairings[pr.AuthorID]
+			// сначала те, с кем правила выполняются, в том числе в резервных командах
+			strategy = withRules(withSkills(withPairings(strategy, reason.pairs), pr.RequiredSkills), reqs)
+			if chosen, fromFallback, err = s.pickReplacement(ctx, txq, strategy, candidates, srcTeam, pr, reviewers); err != nil {
+				return err
+			}
+		}
+		newReviewerID = chosen.User.ID
+		relaxed = rules.unmet(append(usersAsCandidates(remaining), chosen))
+
+		if err := txq.RemoveReviewerFromPR(ctx, db.RemoveReviewerFromPRParams{
+			PrID:   prID,
+			UserID: oldReviewerID,
+		}); err != nil {
+			return err
+		}
+		if err := closeAssignment(ctx, txq, prID, oldReviewerID); err != nil {
+			return err
+		}
+
+		if err := txq.AddReviewerToPR(ctx, db.AddReviewerToPRParams{
+			PrID:   prID,
+			UserID: newReviewerID,
+			TeamID: chosen.SourceTeam,
+		}); err != nil {
+			return err
+		}
+		inputs := reason.inputs(chosen)
+		inputs.FromFallback = fromFallback
+		inputs.Requested = requestedID != uuid.Nil
+		if err := recordAssignment(ctx, txq, prID, chosen, reason, inputs); err != nil {
+			return err
+		}
 
-	candidates, err := s.store.GetCandidatesForReassignment(ctx, db.GetCandidatesForReassignmentParams{
-		ID:   oldReviewerID,
-		PrID: prID,
+		updatedPR, err := txq.TouchPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		details, err = loadPRDetails(ctx, txq, updatedPR)
+		return err
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if len(candidates) == 0 {
-		return nil, fmt.Errorf("NO_CANDIDATE: no active replacement candidate in team")
+	details.ReplacedBy = newReviewerID.String()
+	if fromFallback {
+		details.FallbackReviewers = []string{newReviewerID.String()}
 	}
+	details.RelaxedRules = relaxed
 
-	newReviewer := candidates[0]
-	newReviewerID := newReviewer.ID
+	return details, nil
+}
 
-	if err := s.store.RemoveReviewerFromPR(ctx, db.RemoveReviewerFromPRParams{
-		PrID:   prID,
-		UserID: oldReviewerID,
-	}); err != nil {
-		return nil, err
+// выбирает замену стратегией среди кандидатов команды teamID, а если их нет - в её резервных командах
+func (s *Service) pickReplacement(ctx context.Context, q *db.Queries, strategy AssignmentStrategy, candidates []Candidate, teamID pgtype.UUID, pr db.PullRequest, reviewers []db.User) (Candidate, bool, error) {
+	if picked := strategy.Pick(s.rng, candidates, 1); len(picked) > 0 {
+		return picked[0], false, nil
 	}
-
-	if err := s.store.AddReviewerToPR(ctx, db.AddReviewerToPRParams{
-		PrID:   prID,
-		UserID: newReviewerID,
-	}); err != nil {
-		return nil, err
+	if teamID.Valid {
+		// в команде заменяемого никого нет - ищем в её резервных командах
+		exclude := map[uuid.UUID]bool{pr.AuthorID: true}
+		for _, r := range reviewers {
+			exclude[r.ID] = true
+		}
+		picked, err := s.pickFromFallbacks(ctx, q, teamID.Bytes, strategy, exclude, 1)
+		if err != nil {
+			return Candidate{}, false, err
+		}
+		if len(picked) > 0 {
+			return picked[0], true, nil
+		}
 	}
+	return Candidate{}, false, fmt.Errorf("NO_CANDIDATE: no active replacement candidate in team")
+}
 
-	updatedPR, err := s.store.GetPullRequest(ctx, prID)
+// проверяет явно выбранную замену: активен, из команды заменяемого, не автор, ещё не ревьювит.
+// Окончательно решает список кандидатов - в нём учтены и отсутствия, и лимиты открытых ревью.
+func checkRequestedReviewer(ctx context.Context, q *db.Queries, userID uuid.UUID, oldReviewer db.User, teamID pgtype.UUID, pr db.PullRequest, candidates []Candidate) error {
+	user, err := q.GetUser(ctx, userID)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("NOT_FOUND: new reviewer not found")
 	}
-
-	updatedReviewers, _ := s.store.GetReviewersForPR(ctx, prID)
-	reviewerIDs := make([]string, len(updatedReviewers))
-	for i, r := range updatedReviewers {
-		reviewerIDs[i] = r.ID.String()
+	switch {
+	case user.ID == pr.AuthorID:
+		return fmt.Errorf("INVALID_REVIEWER: new reviewer is the author of the PR")
+	case !user.IsActive:
+		return fmt.Errorf("INVALID_REVIEWER: new reviewer is not active")
 	}
-
-	createdAt := updatedPR.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00")
-
-	details := &PRDetails{
-		PullRequestID:     updatedPR.ID.String(),
-		PullRequestName:   updatedPR.Title,
-		AuthorID:          updatedPR.AuthorID.String(),
-		Status:            updatedPR.Status,
-		AssignedReviewers: reviewerIDs,
-		CreatedAt:         &createdAt,
-		ReplacedBy:        newReviewerID.String(),
+	teams, err := q.GetUserTeams(ctx, userID)
+	if err != nil {
+		return err
 	}
-
-	return details, nil
+	if !teamID.Valid || !slices.ContainsFunc(teams, func(t db.Team) bool { return t.ID == teamID.Bytes }) {
+		return fmt.Errorf("INVALID_REVIEWER: new reviewer is not in the team of the replaced reviewer")
+	}
+	for _, c := range candidates {
+		if c.User.ID == userID {
+			return nil
+		}
+	}
+	if user.ID == oldReviewer.ID {
+		return fmt.Errorf("INVALID_REVIEWER: new reviewer is already assigned to this PR")
+	}
+	reviewers, err := q.GetReviewersForPR(ctx, pr.ID)
+	if err != nil {
+		return err
+	}
+	for _, r := range reviewers {
+		if r.ID == userID {
+			return fmt.Errorf("INVALID_REVIEWER: new reviewer is already assigned to this PR")
+		}
+	}
+	return fmt.Errorf("INVALID_REVIEWER: new reviewer is absent or has reached the open reviews limit")
 }
 
 func (s *Service) GetAssignmentStats(ctx context.Context) (*AssignmentStats, error) {
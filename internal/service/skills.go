@@ -0,0 +1,87 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+)
+
+// задаёт навыки пользователя (полностью заменяет прежний список)
+func (s *Service) SetUserSkills(ctx context.Context, userID uuid.UUID, skills []string) (*UserDetails, error) {
+	user, err := s.store.SetUserSkills(ctx, db.SetUserSkillsParams{ID: userID, Skills: normalizeSkills(skills)})
+	if err != nil {
+		return nil, err
+	}
+
+	details := &UserDetails{User: user}
+	if user.TeamID.Valid {
+		if team, err := s.store.GetTeam(ctx, user.TeamID.Bytes); err == nil {
+			details.TeamName = team.Name
+		}
+	}
+	return details, nil
+}
+
+// приводит навыки к нижнему регистру, убирает пустые и повторы
+func normalizeSkills(skills []string) []string {
+	out := make([]string, 0, len(skills))
+	for _, sk := range skills {
+		sk = strings.ToLower(strings.TrimSpace(sk))
+		if sk != "" && !slices.Contains(out, sk) {
+			out = append(out, sk)
+		}
+	}
+	return out
+}
+
+// оборачивает стратегию ранжированием по совпадению навыков
+func withSkills(base AssignmentStrategy, required []string) AssignmentStrategy {
+	if len(required) == 0 {
+		return base
+	}
+	return skillRankedStrategy{base: base, required: required}
+}
+
+// кандидаты группируются по числу совпавших навыков; стратегия команды выбирает сначала
+// среди лучшей группы и переходит к следующей, только если мест осталось больше
+type skillRankedStrategy struct {
+	base     AssignmentStrategy
+	required []string
+}
+
+func (s skillRankedStrategy) Pick(rng *rand.Rand, candidates []Candidate, n int) []Candidate {
+	tiers := make(map[int][]Candidate)
+	for _, c := range candidates {
+		overlap := skillOverlap(c.User.Skills, s.required)
+		tiers[overlap] = append(tiers[overlap], c)
+	}
+	levels := make([]int, 0, len(tiers))
+	for level := range tiers {
+		levels = append(levels, level)
+	}
+	slices.SortFunc(levels, func(a, b int) int { return cmp.Compare(b, a) })
+
+	picked := make([]Candidate, 0, min(n, len(candidates)))
+	for _, level := range levels {
+		if len(picked) >= n {
+			break
+		}
+		picked = append(picked, s.base.Pick(rng, tiers[level], n-len(picked))...)
+	}
+	return picked
+}
+
+func skillOverlap(skills, required []string) int {
+	n := 0
+	for _, r := range required {
+		if slices.Contains(skills, r) {
+			n++
+		}
+	}
+	return n
+}
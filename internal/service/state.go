@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+)
+
+// состояния PR
+const (
+	StatusDraft  = "DRAFT"
+	StatusOpen   = "OPEN"
+	StatusMerged = "MERGED"
+	StatusClosed = "CLOSED"
+)
+
+// переход между состояниями PR
+type prTransition struct {
+	name string
+	from []string
+	to   string
+}
+
+// все допустимые переходы; MERGED - конечное состояние.
+// Черновик получает ревьюверов при переходе в OPEN, у CLOSED и MERGED состав заморожен.
+var (
+	transitionReady  = prTransition{name: "mark ready", from: []string{StatusDraft}, to: StatusOpen}
+	transitionMerge  = prTransition{name: "merge", from: []string{StatusOpen}, to: StatusMerged}
+	transitionClose  = prTransition{name: "close", from: []string{StatusDraft, StatusOpen}, to: StatusClosed}
+	transitionReopen = prTransition{name: "reopen", from: []string{StatusClosed}, to: StatusOpen}
+)
+
+func (t prTransition) check(status string) error {
+	if !slices.Contains(t.from, status) {
+		return fmt.Errorf("INVALID_TRANSITION: cannot %s PR in status %s", t.name, status)
+	}
+	return nil
+}
+
+// ошибка, если состав ревьюверов PR в его состоянии менять нельзя
+func reviewersFrozen(pr db.PullRequest) error {
+	switch pr.Status {
+	case StatusMerged:
+		return fmt.Errorf("PR_MERGED: cannot change reviewers on merged PR")
+	case StatusClosed:
+		return fmt.Errorf("PR_CLOSED: cannot change reviewers on closed PR")
+	case StatusDraft:
+		return fmt.Errorf("PR_DRAFT: reviewers are assigned when the draft is marked ready")
+	}
+	return nil
+}
+
+// отмечает черновик готовым к ревью и назначает ревьюверов по тем же правилам, что и при
+// создании PR. Навыки и число ревьюверов берутся из черновика, изменённые файлы и
+// репозиторий (для владельцев кода) - из opts.
+func (s *Service) MarkPullRequestReady(ctx context.Context, prIDStr string, opts CreatePROptions) (*PRDetails, error) {
+	prID, err := uuid.Parse(prIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pull_request_id format: %w", err)
+	}
+
+	var details *PRDetails
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		// статус проверяем по строке, заблокированной до конца транзакции
+		pr, err := txq.GetPullRequestForUpdate(ctx, prID)
+		if err != nil {
+			return fmt.Errorf("NOT_FOUND: PR not found")
+		}
+		if err := transitionReady.check(pr.Status); err != nil {
+			return err
+		}
+		author, err := txq.GetUser(ctx, pr.AuthorID)
+		if err != nil {
+			return err
+		}
+
+		// подбираем в команде черновика
+		opts.TeamName = ""
+		if pr.TeamID.Valid {
+			team, err := txq.GetTeam(ctx, pr.TeamID.Bytes)
+			if err != nil {
+				return err
+			}
+			opts.TeamName = team.Name
+		}
+		count := int(pr.TargetReviewers)
+		opts.ReviewersCount = &count
+		opts.RequiredSkills = pr.RequiredSkills
+
+		sel, err := s.selectReviewers(ctx, txq, author, opts)
+		if err != nil {
+			return err
+		}
+		if pr, err = txq.UpdatePullRequestStatus(ctx, db.UpdatePullRequestStatusParams{ID: prID, Status: transitionReady.to}); err != nil {
+			return err
+		}
+		if err := recordEvent(ctx, txq, prID, prEvent{typ: EventStatusChanged, from: StatusDraft, to: pr.Status}); err != nil {
+			return err
+		}
+		assigned, err := assignSelected(ctx, txq, pr.ID, sel)
+		if err != nil {
+			return err
+		}
+		if details, err = loadPRDetails(ctx, txq, pr); err != nil {
+			return err
+		}
+		details.AssignedReviewers = assigned
+		sel.annotate(details)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// закрывает PR без слияния; ревьюверы остаются, но менять их больше нельзя.
+// Повторное закрытие ничего не меняет.
+func (s *Service) ClosePullRequest(ctx context.Context, prIDStr string) (*PRDetails, error) {
+	return s.changeStatus(ctx, prIDStr, transitionClose, false)
+}
+
+// открывает закрытый PR заново (уже открытый не меняется); если ревьюверов у него меньше
+// целевого числа, они добираются
+func (s *Service) ReopenPullRequest(ctx context.Context, prIDStr string) (*PRDetails, error) {
+	return s.changeStatus(ctx, prIDStr, transitionReopen, true)
+}
+
+func (s *Service) changeStatus(ctx context.Context, prIDStr string, t prTransition, topUp bool) (*PRDetails, error) {
+	prID, err := uuid.Parse(prIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pull_request_id format: %w", err)
+	}
+
+	var details *PRDetails
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		// статус проверяем по строке, заблокированной до конца транзакции
+		pr, err := txq.GetPullRequestForUpdate(ctx, prID)
+		if err != nil {
+			return fmt.Errorf("NOT_FOUND: PR not found")
+		}
+		if pr.Status != t.to {
+			if err := t.check(pr.Status); err != nil {
+				return err
+			}
+			from := pr.Status
+			if pr, err = txq.UpdatePullRequestStatus(ctx, db.UpdatePullRequestStatusParams{ID: prID, Status: t.to}); err != nil {
+				return err
+			}
+			if err := recordEvent(ctx, txq, prID, prEvent{typ: EventStatusChanged, from: from, to: pr.Status}); err != nil {
+				return err
+			}
+			if topUp {
+				if _, err := s.topUpUnderstaffed(ctx, txq, topUpScope{prIDs: []uuid.UUID{prID}}); err != nil {
+					return err
+				}
+			}
+		}
+		details, err = loadPRDetails(ctx, txq, pr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// названия стратегий, как они хранятся в teams.assignment_strategy
+const (
+	StrategyRandom      = "random"
+	StrategyRoundRobin  = "round_robin"
+	StrategyLeastLoaded = "least_loaded"
+	StrategyWeighted    = "weighted"
+)
+
+// стратегия для команд, которые не выбрали свою
+const DefaultStrategy = StrategyLeastLoaded
+
+// кандидат в ревьюверы вместе с данными о его загрузке
+type Candidate struct {
+	User           db.User
+	OpenReviews    int64
+	LastAssignedAt pgtype.Timestamptz
+	// действующий лимит открытых ревью (свой или основной команды); NULL - без ограничения
+	MaxOpenReviews pgtype.Int4
+	// команда, через которую кандидат попал в выборку; NULL - не через команду (владелец кода)
+	SourceTeam pgtype.UUID
+}
+
+// AssignmentStrategy выбирает до n ревьюверов из подходящих кандидатов.
+// Кандидаты уже отфильтрованы по правилам (команда, активность, не автор),
+// стратегия отвечает только за порядок выбора и не должна менять входной срез.
+// Вся случайность берётся из rng, чтобы выбор можно было воспроизвести по seed.
+type AssignmentStrategy interface {
+	Pick(rng *rand.Rand, candidates []Candidate, n int) []Candidate
+}
+
+var strategies = map[string]AssignmentStrategy{
+	StrategyRandom:      randomStrategy{},
+	StrategyRoundRobin:  roundRobinStrategy{},
+	StrategyLeastLoaded: leastLoadedStrategy{},
+	StrategyWeighted:    weightedStrategy{},
+}
+
+// возвращает стратегию по имени
+func StrategyByName(name string) (AssignmentStrategy, bool) {
+	st, ok := strategies[name]
+	return st, ok
+}
+
+// случайный выбор с равной вероятностью
+type randomStrategy struct{}
+
+func (randomStrategy) Pick(rng *rand.Rand, candidates []Candidate, n int) []Candidate {
+	shuffled := slices.Clone(candidates)
+	rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return firstN(shuffled, n)
+}
+
+// по кругу: сначала те, кого дольше всех не назначали (или не назначали никогда)
+type roundRobinStrategy struct{}
+
+func (roundRobinStrategy) Pick(_ *rand.Rand, candidates []Candidate, n int) []Candidate {
+	ordered := slices.Clone(candidates)
+	slices.SortStableFunc(ordered, func(a, b Candidate) int {
+		switch {
+		case !a.LastAssignedAt.Valid && !b.LastAssignedAt.Valid:
+			return 0
+		case !a.LastAssignedAt.Valid:
+			return -1
+		case !b.LastAssignedAt.Valid:
+			return 1
+		}
+		return a.LastAssignedAt.Time.Compare(b.LastAssignedAt.Time)
+	})
+	return firstN(ordered, n)
+}
+
+// наименее загруженные по числу OPEN ревью, при равенстве случайно
+type leastLoadedStrategy struct{}
+
+func (leastLoadedStrategy) Pick(rng *rand.Rand, candidates []Candidate, n int) []Candidate {
+	ordered := randomStrategy{}.Pick(rng, candidates, len(candidates))
+	slices.SortStableFunc(ordered, func(a, b Candidate) int {
+		return cmp.Compare(a.OpenReviews, b.OpenReviews)
+	})
+	return firstN(ordered, n)
+}
+
+// случайный выбор с весом 1/(1+open_reviews): загруженные выбираются реже, но не исключаются
+type weightedStrategy struct{}
+
+func (weightedStrategy) Pick(rng *rand.Rand, candidates []Candidate, n int) []Candidate {
+	pool := slices.Clone(candidates)
+	picked := make([]Candidate, 0, min(n, len(pool)))
+	for len(picked) < n && len(pool) > 0 {
+		total := 0.0
+		for _, c := range pool {
+			total += weightOf(c)
+		}
+		r := rng.Float64() * total
+		idx := len(pool) - 1
+		for i, c := range pool {
+			r -= weightOf(c)
+			if r < 0 {
+				idx = i
+				break
+			}
+		}
+		picked = append(picked, pool[idx])
+		pool = slices.Delete(pool, idx, idx+1)
+	}
+	return picked
+}
+
+func weightOf(c Candidate) float64 {
+	return 1 / float64(1+c.OpenReviews)
+}
+
+func initialCandidate(r db.GetCandidatesForInitialReviewRow, teamID uuid.UUID) Candidate {
+	return Candidate{
+		User:           db.User{ID: r.ID, Name: r.Name, IsActive: r.IsActive, TeamID: r.TeamID, Skills: r.Skills, Seniority: r.Seniority},
+		OpenReviews:    r.OpenReviews,
+		LastAssignedAt: r.LastAssignedAt,
+		MaxOpenReviews: r.MaxOpenReviews,
+		SourceTeam:     pgtype.UUID{Bytes: teamID, Valid: true},
+	}
+}
+
+func reassignmentCandidate(r db.GetCandidatesForReassignmentRow, teamID uuid.UUID) Candidate {
+	return Candidate{
+		User:           db.User{ID: r.ID, Name: r.Name, IsActive: r.IsActive, TeamID: r.TeamID, Skills: r.Skills, Seniority: r.Seniority},
+		OpenReviews:    r.OpenReviews,
+		LastAssignedAt: r.LastAssignedAt,
+		MaxOpenReviews: r.MaxOpenReviews,
+		SourceTeam:     pgtype.UUID{Bytes: teamID, Valid: true},
+	}
+}
+
+func teamCandidate(r db.GetActiveTeamCandidatesRow, teamID uuid.UUID) Candidate {
+	return Candidate{
+		User:           db.User{ID: r.ID, Name: r.Name, IsActive: r.IsActive, TeamID: r.TeamID, Skills: r.Skills, Seniority: r.Seniority},
+		OpenReviews:    r.OpenReviews,
+		LastAssignedAt: r.LastAssignedAt,
+		MaxOpenReviews: r.MaxOpenReviews,
+		SourceTeam:     pgtype.UUID{Bytes: teamID, Valid: true},
+	}
+}
+
+func firstN(candidates []Candidate, n int) []Candidate {
+	if n < len(candidates) {
+		return candidates[:n]
+	}
+	return candidates
+}
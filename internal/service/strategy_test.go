@@ -0,0 +1,100 @@
+package service
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// кандидат с именем name: id выводится из имени, чтобы выбор по seed не зависел от запуска
+func candidate(name string, openReviews int64) Candidate {
+	return Candidate{
+		User:        db.User{ID: uuid.NewSHA1(uuid.Nil, []byte(name)), Name: name, IsActive: true},
+		OpenReviews: openReviews,
+	}
+}
+
+func assignedAt(c Candidate, at time.Time) Candidate {
+	c.LastAssignedAt = pgtype.Timestamptz{Time: at, Valid: true}
+	return c
+}
+
+func names(candidates []Candidate) []string {
+	out := make([]string, len(candidates))
+	for i, c := range candidates {
+		out[i] = c.User.Name
+	}
+	return out
+}
+
+// rng сервиса с фиксированным seed, как его задаёт SEED
+func seededRand(seed uint64) *rand.Rand {
+	return NewService(nil, WithRandSource(rand.NewPCG(seed, seed))).rng
+}
+
+func TestStrategyPick(t *testing.T) {
+	base := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	pool := []Candidate{
+		assignedAt(candidate("alice", 3), base.Add(2*time.Hour)),
+		assignedAt(candidate("bob", 0), base),
+		candidate("carol", 1),
+		assignedAt(candidate("dave", 0), base.Add(time.Hour)),
+		candidate("erin", 5),
+	}
+	tests := []struct {
+		strategy string
+		n        int
+		want     []string
+	}{
+		{StrategyRandom, 2, []string{"carol", "alice"}},
+		{StrategyRandom, 10, []string{"carol", "alice", "bob", "erin", "dave"}},
+		{StrategyRoundRobin, 3, []string{"carol", "erin", "bob"}},
+		{StrategyLeastLoaded, 2, []string{"bob", "dave"}},
+		{StrategyLeastLoaded, 3, []string{"bob", "dave", "carol"}},
+		{StrategyWeighted, 2, []string{"bob", "carol"}},
+		{StrategyWeighted, 5, []string{"bob", "carol", "dave", "alice", "erin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			st, ok := StrategyByName(tt.strategy)
+			if !ok {
+				t.Fatalf("unknown strategy %q", tt.strategy)
+			}
+			input := slices.Clone(pool)
+			got := names(st.Pick(seededRand(42), input, tt.n))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Pick(n=%d) = %v, want %v", tt.n, got, tt.want)
+			}
+			if !slices.EqualFunc(input, pool, func(a, b Candidate) bool { return a.User.ID == b.User.ID }) {
+				t.Errorf("Pick changed the input slice")
+			}
+		})
+	}
+}
+
+// один и тот же seed - один и тот же выбор
+func TestStrategyPickReproducible(t *testing.T) {
+	pool := []Candidate{candidate("alice", 0), candidate("bob", 0), candidate("carol", 0), candidate("dave", 0)}
+	for name, st := range strategies {
+		t.Run(name, func(t *testing.T) {
+			first := names(st.Pick(seededRand(7), pool, 2))
+			second := names(st.Pick(seededRand(7), pool, 2))
+			if !slices.Equal(first, second) {
+				t.Errorf("same seed gave %v and %v", first, second)
+			}
+		})
+	}
+}
+
+func TestStrategyPickEmpty(t *testing.T) {
+	for name, st := range strategies {
+		if got := st.Pick(seededRand(1), nil, 3); len(got) != 0 {
+			t.Errorf("%s: Pick(nil) = %v, want none", name, names(got))
+		}
+	}
+}
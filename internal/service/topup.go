@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// OPEN PR, у которого ревьюверов меньше целевого числа
+type UnderstaffedPR struct {
+	PullRequestID     string   `json:"pull_request_id"`
+	PullRequestName   string   `json:"pull_request_name"`
+	AuthorID          string   `json:"author_id"`
+	TargetReviewers   int      `json:"target_reviewers"`
+	AssignedReviewers []string `json:"assigned_reviewers"`
+	CreatedAt         *string  `json:"createdAt,omitempty"`
+	UpdatedAt         *string  `json:"updatedAt,omitempty"`
+}
+
+// ревьюверы, добавленные на PR при автоматическом доборе
+type TopUp struct {
+	PullRequestID  string   `json:"pull_request_id"`
+	AddedReviewers []string `json:"added_reviewers"`
+	// добавленные из резервных команд
+	FallbackReviewers []string `json:"fallback_reviewers,omitempty"`
+	// правила состава команды PR, которые не удалось выполнить
+	RelaxedRules []string `json:"relaxed_rules,omitempty"`
+}
+
+// получает OPEN PR, которым всё ещё не хватает ревьюверов
+func (s *Service) GetUnderstaffedPRs(ctx context.Context) ([]UnderstaffedPR, error) {
+	prs, err := s.store.GetUnderstaffedPullRequests(ctx, db.GetUnderstaffedPullRequestsParams{})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]UnderstaffedPR, len(prs))
+	for i, pr := range prs {
+		reviewers := make([]string, len(pr.ReviewerIds))
+		for j, id := range pr.ReviewerIds {
+			reviewers[j] = id.String()
+		}
+		result[i] = UnderstaffedPR{
+			PullRequestID:     pr.ID.String(),
+			PullRequestName:   pr.Title,
+			AuthorID:          pr.AuthorID.String(),
+			TargetReviewers:   int(pr.TargetReviewers),
+			AssignedReviewers: reviewers,
+			CreatedAt:         formatTime(pr.CreatedAt),
+			UpdatedAt:         formatTime(pr.UpdatedAt),
+		}
+	}
+	return result, nil
+}
+
+// какие PR добирать: PR команд teamIDs и PR из prIDs; пустой список - без ограничения
+type topUpScope struct {
+	teamIDs []uuid.UUID
+	prIDs   []uuid.UUID
+}
+
+// добирает ревьюверов на OPEN PR из scope ниже целевого числа: из команды PR, затем из её
+// резервных команд, стратегией команды с учётом навыков PR и правил состава команды. Вызывается, когда появляются
+// новые подходящие кандидаты (добавление участников, повторная активация, конец отсутствия).
+// Кандидаты читаются по разу на команду, назначения записываются пакетно.
+func (s *Service) topUpUnderstaffed(ctx context.Context, q *db.Queries, scope topUpScope) ([]TopUp, error) {
+	result := make([]TopUp, 0)
+	prs, err := q.GetUnderstaffedPullRequests(ctx, db.GetUnderstaffedPullRequestsParams{
+		TeamIds: scope.teamIDs,
+		PrIds:   scope.prIDs,
+	})
+	if err != nil || len(prs) == 0 {
+		return result, err
+	}
+
+	authorIDs := make([]uuid.UUID, len(prs))
+	for i, pr := range prs {
+		authorIDs[i] = pr.AuthorID
+	}
+	pairings, err := s.recentPairings(ctx, q, uniqueIDs(authorIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[uuid.UUID]*replacementPools)
+	var newPRIDs, newUserIDs, newTeamIDs []uuid.UUID
+	var history assignmentLog
+	now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	for _, pr := range prs {
+		// PR без команды добирать не из кого
+		if !pr.TeamID.Valid {
+			continue
+		}
+		src, ok := sources[pr.TeamID.Bytes]
+		if !ok {
+			if src, err = newReplacementPools(ctx, q, pr.TeamID.Bytes, db.Team{}); err != nil {
+				return nil, err
+			}
+			sources[pr.TeamID.Bytes] = src
+		}
+		strategy := withSkills(withPairings(strategyOf(src.team), pairings[pr.AuthorID]), pr.RequiredSkills)
+
+		exclude := map[uuid.UUID]bool{pr.AuthorID: true}
+		for _, id := range pr.ReviewerIds {
+			exclude[id] = true
+		}
+		missing := int(pr.TargetReviewers) - len(pr.ReviewerIds)
+		picked, err := s.pickFromPools(ctx, q, src, strategy, exclude, missing)
+		if err != nil {
+			return nil, err
+		}
+		item := TopUp{PullRequestID: pr.ID.String()}
+		rules := seniorityRules{requireSenior: pr.RequireSenior, juniorsNotAlone: pr.JuniorsNotAlone}
+		current := reviewerCandidates(pr.ReviewerIds, pr.ReviewerSeniorities)
+		picked, item.RelaxedRules, err = s.applyRules(ctx, q, src, rules, strategy, current, picked, exclude, missing)
+		if err != nil {
+			return nil, err
+		}
+		if len(picked) == 0 {
+			continue
+		}
+
+		reason := assignmentReason{
+			reason:   AssignedTopUp,
+			strategy: strategyNameOf(src.team),
+			required: pr.RequiredSkills,
+			pairs:    pairings[pr.AuthorID],
+		}
+		for _, c := range picked {
+			inputs := reason.inputs(c)
+			inputs.FromFallback = src.borrowed(c)
+			if err := history.add(pr.ID, c.User.ID, c.SourceTeam, reason, inputs); err != nil {
+				return nil, err
+			}
+			// следующие PR видят обновлённую загрузку и лимиты
+			noteAssigned(sources, c.User.ID, now)
+			item.AddedReviewers = append(item.AddedReviewers, c.User.ID.String())
+			if src.borrowed(c) {
+				item.FallbackReviewers = append(item.FallbackReviewers, c.User.ID.String())
+			}
+			newPRIDs = append(newPRIDs, pr.ID)
+			newUserIDs = append(newUserIDs, c.User.ID)
+			newTeamIDs = append(newTeamIDs, c.SourceTeam.Bytes)
+		}
+		result = append(result, item)
+	}
+
+	if len(newPRIDs) == 0 {
+		return result, nil
+	}
+	if err := q.AddReviewersToPRs(ctx, db.AddReviewersToPRsParams{PrIds: newPRIDs, UserIds: newUserIDs, TeamIds: newTeamIDs}); err != nil {
+		return nil, err
+	}
+	if err := history.write(ctx, q); err != nil {
+		return nil, err
+	}
+	if err := q.TouchPullRequests(ctx, uniqueIDs(newPRIDs)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// команды, в которых состоят пользователи, - их PR может закрыть вернувшийся участник
+func usersTeams(ctx context.Context, q *db.Queries, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var teamIDs []uuid.UUID
+	for _, id := range userIDs {
+		teams, err := q.GetUserTeams(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range teams {
+			teamIDs = append(teamIDs, t.ID)
+		}
+	}
+	return uniqueIDs(teamIDs), nil
+}
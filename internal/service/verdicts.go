@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Narotan/pr-reviewer-service/internal/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// решения ревьювера по PR
+const (
+	VerdictApproved         = "APPROVED"
+	VerdictChangesRequested = "CHANGES_REQUESTED"
+	VerdictCommented        = "COMMENTED"
+)
+
+var verdicts = []string{VerdictApproved, VerdictChangesRequested, VerdictCommented}
+
+// решение ревьювера и время его отправки
+type ReviewVerdict struct {
+	UserID      string `json:"user_id"`
+	Verdict     string `json:"verdict"`
+	SubmittedAt string `json:"submitted_at"`
+}
+
+// проверяет, что решение из допустимого набора
+func IsValidVerdict(verdict string) bool {
+	return slices.Contains(verdicts, verdict)
+}
+
+// сохраняет решение назначенного ревьювера; повторная отправка заменяет прежнее решение
+func (s *Service) SubmitReview(ctx context.Context, prIDStr, userIDStr, verdict string) (*PRDetails, error) {
+	if !IsValidVerdict(verdict) {
+		return nil, fmt.Errorf("INVALID_VERDICT: verdict must be one of %v", verdicts)
+	}
+	prID, userID, err := parsePRAndUser(prIDStr, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var details *PRDetails
+	err = s.store.ExecTx(ctx, func(txq *db.Queries) error {
+		pr, err := txq.GetPullRequest(ctx, prID)
+		if err != nil {
+			return fmt.Errorf("NOT_FOUND: PR not found")
+		}
+		// решение по закрытому или слитому PR уже ничего не меняет
+		if err := reviewersFrozen(pr); err != nil {
+			return err
+		}
+		n, err := txq.SetReviewVerdict(ctx, db.SetReviewVerdictParams{
+			PrID:    prID,
+			UserID:  userID,
+			Verdict: pgtype.Text{String: verdict, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("NOT_ASSIGNED: user is not a reviewer of this PR")
+		}
+		if pr, err = txq.TouchPullRequest(ctx, prID); err != nil {
+			return err
+		}
+		details, err = loadPRDetails(ctx, txq, pr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+func verdictsOf(rows []db.GetReviewVerdictsRow) []ReviewVerdict {
+	result := make([]ReviewVerdict, len(rows))
+	for i, r := range rows {
+		result[i] = ReviewVerdict{
+			UserID:      r.UserID.String(),
+			Verdict:     r.Verdict.String,
+			SubmittedAt: r.VerdictAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		}
+	}
+	return result
+}
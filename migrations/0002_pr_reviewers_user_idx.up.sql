@@ -0,0 +1,2 @@
+-- индекс для подсчёта открытых ревью по пользователю
+CREATE INDEX IF NOT EXISTS idx_pr_reviewers_user_id ON pr_reviewers (user_id);
@@ -0,0 +1,2 @@
+ALTER TABLE pr_reviewers DROP COLUMN IF EXISTS assigned_at;
+ALTER TABLE teams DROP COLUMN IF EXISTS assignment_strategy;
@@ -0,0 +1,8 @@
+-- стратегия выбора ревьюверов для команды (NULL - стратегия по умолчанию)
+ALTER TABLE teams
+    ADD COLUMN assignment_strategy TEXT
+        CHECK (assignment_strategy IN ('random', 'round_robin', 'least_loaded', 'weighted'));
+
+-- время назначения нужно стратегии round_robin
+ALTER TABLE pr_reviewers
+    ADD COLUMN assigned_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
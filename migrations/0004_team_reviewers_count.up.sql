@@ -0,0 +1,3 @@
+-- сколько ревьюверов назначать на PR команды
+ALTER TABLE teams
+    ADD COLUMN reviewers_count INTEGER NOT NULL DEFAULT 2 CHECK (reviewers_count >= 0);
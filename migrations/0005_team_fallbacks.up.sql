@@ -0,0 +1,11 @@
+-- резервные команды, из которых берутся ревьюверы, если в своей команде кандидатов не хватает
+CREATE TABLE team_fallbacks (
+    team_id          UUID    NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    fallback_team_id UUID    NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+
+    -- меньше - раньше
+    priority         INTEGER NOT NULL,
+
+    PRIMARY KEY (team_id, fallback_team_id),
+    CHECK (team_id <> fallback_team_id)
+);
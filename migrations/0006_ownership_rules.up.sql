@@ -0,0 +1,15 @@
+-- правила владения кодом в стиле CODEOWNERS: набор правил принадлежит либо команде, либо репозиторию
+CREATE TABLE ownership_rules (
+    team_id    UUID REFERENCES teams(id) ON DELETE CASCADE,
+    repository TEXT,
+
+    -- порядок правил в наборе: при нескольких совпадениях побеждает последнее
+    position   INTEGER NOT NULL,
+    pattern    TEXT    NOT NULL,
+    owner_ids  UUID[]  NOT NULL DEFAULT '{}',
+
+    CHECK ((team_id IS NULL) <> (repository IS NULL))
+);
+
+CREATE UNIQUE INDEX idx_ownership_rules_scope
+    ON ownership_rules (COALESCE(team_id::text, ''), COALESCE(repository, ''), position);
@@ -0,0 +1,6 @@
+-- навыки ревьюверов (go, sql, frontend, ...) и навыки, нужные для PR
+ALTER TABLE users
+    ADD COLUMN skills TEXT[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE pull_requests
+    ADD COLUMN required_skills TEXT[] NOT NULL DEFAULT '{}';
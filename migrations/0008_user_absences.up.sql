@@ -0,0 +1,15 @@
+-- запланированные отсутствия: в это время пользователь не назначается на ревью
+CREATE TABLE user_absences (
+    id           UUID        PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id      UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at    TIMESTAMPTZ NOT NULL,
+    ends_at      TIMESTAMPTZ NOT NULL,
+    reason       TEXT        NOT NULL DEFAULT '',
+
+    -- когда фоновая задача переназначила OPEN ревью пользователя после начала отсутствия
+    processed_at TIMESTAMPTZ,
+
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_user_absences_user ON user_absences (user_id, starts_at, ends_at);
@@ -0,0 +1,7 @@
+-- лимит одновременно открытых ревью: у пользователя, иначе значение по умолчанию команды;
+-- NULL - без ограничения
+ALTER TABLE users
+    ADD COLUMN max_open_reviews INTEGER CHECK (max_open_reviews > 0);
+
+ALTER TABLE teams
+    ADD COLUMN max_open_reviews INTEGER CHECK (max_open_reviews > 0);
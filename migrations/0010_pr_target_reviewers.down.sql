@@ -0,0 +1 @@
+ALTER TABLE pull_requests DROP COLUMN IF EXISTS target_reviewers;
@@ -0,0 +1,10 @@
+-- сколько ревьюверов должно быть у PR; OPEN PR с меньшим числом добираются автоматически
+ALTER TABLE pull_requests
+    ADD COLUMN target_reviewers INTEGER NOT NULL DEFAULT 0 CHECK (target_reviewers >= 0);
+
+-- для существующих PR цель - настройка команды автора (как при создании)
+UPDATE pull_requests pr
+SET target_reviewers = COALESCE(
+    (SELECT t.reviewers_count FROM users u JOIN teams t ON t.id = u.team_id WHERE u.id = pr.author_id),
+    2
+);
@@ -0,0 +1,4 @@
+ALTER TABLE teams
+    DROP COLUMN IF EXISTS juniors_not_alone,
+    DROP COLUMN IF EXISTS require_senior;
+ALTER TABLE users DROP COLUMN IF EXISTS seniority;
@@ -0,0 +1,10 @@
+-- уровень ревьювера и правила команды о составе ревьюверов
+ALTER TABLE users
+    ADD COLUMN seniority TEXT NOT NULL DEFAULT 'middle'
+        CHECK (seniority IN ('junior', 'middle', 'senior'));
+
+-- require_senior: среди ревьюверов PR есть хотя бы один senior;
+-- juniors_not_alone: junior не остаётся единственным типом ревьювера на PR
+ALTER TABLE teams
+    ADD COLUMN require_senior BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN juniors_not_alone BOOLEAN NOT NULL DEFAULT false;
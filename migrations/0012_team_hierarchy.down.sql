@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_teams_parent;
+ALTER TABLE teams
+    DROP CONSTRAINT IF EXISTS teams_parent_not_self,
+    DROP COLUMN IF EXISTS parent_id;
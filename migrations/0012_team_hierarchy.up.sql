@@ -0,0 +1,6 @@
+-- иерархия команд: отделы содержат команды; при нехватке ревьюверов поиск идёт вверх по дереву
+ALTER TABLE teams
+    ADD COLUMN parent_id UUID REFERENCES teams(id) ON DELETE SET NULL,
+    ADD CONSTRAINT teams_parent_not_self CHECK (parent_id <> id);
+
+CREATE INDEX idx_teams_parent ON teams (parent_id);
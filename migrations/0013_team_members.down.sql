@@ -0,0 +1,3 @@
+ALTER TABLE pr_reviewers DROP COLUMN IF EXISTS team_id;
+ALTER TABLE pull_requests DROP COLUMN IF EXISTS team_id;
+DROP TABLE IF EXISTS team_members;
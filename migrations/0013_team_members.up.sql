@@ -0,0 +1,35 @@
+-- участие в командах: пользователь может состоять в нескольких командах, с ролью в каждой.
+-- users.team_id остаётся основной командой пользователя
+CREATE TABLE team_members (
+    team_id UUID NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- роль в команде (например, lead); NULL - без роли
+    role    TEXT,
+
+    PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX idx_team_members_user ON team_members (user_id);
+
+INSERT INTO team_members (team_id, user_id)
+SELECT team_id, id FROM users
+WHERE team_id IS NOT NULL;
+
+-- команда, по которой подбирались ревьюверы PR (по умолчанию основная команда автора)
+ALTER TABLE pull_requests
+    ADD COLUMN team_id UUID REFERENCES teams(id) ON DELETE SET NULL;
+
+UPDATE pull_requests pr
+SET team_id = u.team_id
+FROM users u
+WHERE u.id = pr.author_id;
+
+-- команда, из которой взят ревьювер: из неё же подбирается его замена.
+-- NULL - ревьювер назначен не через команду (владелец кода, вручную)
+ALTER TABLE pr_reviewers
+    ADD COLUMN team_id UUID REFERENCES teams(id) ON DELETE SET NULL;
+
+UPDATE pr_reviewers prr
+SET team_id = u.team_id
+FROM users u
+WHERE u.id = prr.user_id;
@@ -0,0 +1,23 @@
+-- история назначений ревьюверов: как и почему каждый ревьювер попал на PR.
+-- Строки не удаляются при переназначении - снятому назначению проставляется removed_at
+CREATE TABLE pr_assignments (
+    id               UUID        PRIMARY KEY DEFAULT uuid_generate_v4(),
+    pr_id            UUID        NOT NULL REFERENCES pull_requests(id) ON DELETE CASCADE,
+    user_id          UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- initial, owner, fallback, reassignment, manual, top_up; unknown - назначено до миграции
+    reason           TEXT        NOT NULL,
+    -- кого заменил ревьювер при переназначении
+    replaced_user_id UUID        REFERENCES users(id) ON DELETE SET NULL,
+    -- команда, из которой взят ревьювер
+    team_id          UUID        REFERENCES teams(id) ON DELETE SET NULL,
+    strategy         TEXT,
+    -- входные данные выбора: загрузка, совпавшие навыки, недавние пары с автором
+    inputs           JSONB       NOT NULL DEFAULT '{}',
+    assigned_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    removed_at       TIMESTAMPTZ
+);
+
+CREATE INDEX idx_pr_assignments_pr ON pr_assignments (pr_id, assigned_at);
+
+INSERT INTO pr_assignments (pr_id, user_id, reason, team_id, assigned_at)
+SELECT pr_id, user_id, 'unknown', team_id, assigned_at FROM pr_reviewers;
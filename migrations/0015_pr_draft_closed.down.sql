@@ -0,0 +1,12 @@
+-- значения из enum удалить нельзя - пересоздаём тип. Черновики и закрытые PR становятся
+-- OPEN: закрытый PR не был слит, и выдавать его за слитый нельзя
+UPDATE pull_requests SET status = 'OPEN' WHERE status IN ('DRAFT', 'CLOSED');
+
+ALTER TYPE pr_status RENAME TO pr_status_old;
+CREATE TYPE pr_status AS ENUM ('OPEN', 'MERGED');
+
+ALTER TABLE pull_requests ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE pull_requests ALTER COLUMN status TYPE pr_status USING status::text::pr_status;
+ALTER TABLE pull_requests ALTER COLUMN status SET DEFAULT 'OPEN';
+
+DROP TYPE pr_status_old;
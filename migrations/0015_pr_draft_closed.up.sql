@@ -0,0 +1,4 @@
+-- DRAFT: ревьюверы не назначаются, пока PR не отмечен готовым к ревью;
+-- CLOSED: PR отклонён, состав ревьюверов заморожен, как у MERGED
+ALTER TYPE pr_status ADD VALUE IF NOT EXISTS 'DRAFT';
+ALTER TYPE pr_status ADD VALUE IF NOT EXISTS 'CLOSED';
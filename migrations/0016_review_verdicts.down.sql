@@ -0,0 +1,2 @@
+ALTER TABLE pr_reviewers DROP COLUMN IF EXISTS verdict_at;
+ALTER TABLE pr_reviewers DROP COLUMN IF EXISTS verdict;
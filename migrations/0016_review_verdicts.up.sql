@@ -0,0 +1,4 @@
+-- решение ревьювера по PR; NULL - ещё не высказался
+ALTER TABLE pr_reviewers
+    ADD COLUMN verdict    TEXT CHECK (verdict IN ('APPROVED', 'CHANGES_REQUESTED', 'COMMENTED')),
+    ADD COLUMN verdict_at TIMESTAMPTZ;
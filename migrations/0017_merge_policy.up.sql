@@ -0,0 +1,8 @@
+-- политика слияния команды: минимум одобрений и запрет при CHANGES_REQUESTED
+ALTER TABLE teams
+    ADD COLUMN min_approvals INTEGER NOT NULL DEFAULT 0 CHECK (min_approvals >= 0),
+    ADD COLUMN block_on_changes_requested BOOLEAN NOT NULL DEFAULT false;
+
+-- PR слит в обход политики слияния
+ALTER TABLE pull_requests
+    ADD COLUMN merge_forced BOOLEAN NOT NULL DEFAULT false;
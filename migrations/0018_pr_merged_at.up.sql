@@ -0,0 +1,8 @@
+-- время слияния ставится один раз; updated_at меняется при любом изменении PR
+ALTER TABLE pull_requests
+    ADD COLUMN merged_at TIMESTAMPTZ;
+
+-- для уже слитых PR лучшее, что есть, - последнее изменение
+UPDATE pull_requests
+SET merged_at = updated_at
+WHERE status = 'MERGED';
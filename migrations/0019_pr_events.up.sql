@@ -0,0 +1,39 @@
+-- лента событий PR: создание, назначения, переназначения, снятия ревьюверов, смены статуса.
+-- Только добавление: строки не меняются и не удаляются вместе с пользователями,
+-- поэтому у ссылок на пользователей нет внешних ключей
+CREATE TABLE pr_events (
+    id               BIGSERIAL   PRIMARY KEY,
+    pr_id            UUID        NOT NULL REFERENCES pull_requests(id) ON DELETE CASCADE,
+    -- created, reviewer_assigned, reviewer_reassigned, reviewer_removed, status_changed, merged
+    event_type       TEXT        NOT NULL,
+    -- кто выполнил действие; NULL - сервис сам (фоновые задачи) или не указано
+    actor_id         UUID,
+    -- ревьювер, которого касается событие, и кого он заменил при переназначении
+    user_id          UUID,
+    replaced_user_id UUID,
+    from_status      TEXT,
+    to_status        TEXT,
+    details          JSONB       NOT NULL DEFAULT '{}',
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_pr_events_pr ON pr_events (pr_id, created_at, id);
+
+-- восстанавливаем то, что известно о прошлом: создание, историю назначений и слияние
+INSERT INTO pr_events (pr_id, event_type, user_id, replaced_user_id, from_status, to_status, details, created_at)
+SELECT pr_id, event_type, user_id, replaced_user_id, from_status, to_status, details, created_at
+FROM (
+    SELECT id AS pr_id, 'created' AS event_type, NULL::uuid AS user_id, NULL::uuid AS replaced_user_id,
+           NULL::text AS from_status, NULL::text AS to_status, '{}'::jsonb AS details, created_at, 0 AS ord
+    FROM pull_requests
+    UNION ALL
+    SELECT pr_id,
+           CASE WHEN replaced_user_id IS NULL THEN 'reviewer_assigned' ELSE 'reviewer_reassigned' END,
+           user_id, replaced_user_id, NULL, NULL, jsonb_build_object('reason', reason), assigned_at, 1
+    FROM pr_assignments
+    UNION ALL
+    SELECT id, 'merged', NULL, NULL, 'OPEN', 'MERGED', jsonb_build_object('forced', merge_forced), merged_at, 2
+    FROM pull_requests
+    WHERE status = 'MERGED' AND merged_at IS NOT NULL
+) e
+ORDER BY created_at, ord;
@@ -0,0 +1 @@
+DROP VIEW IF EXISTS reviewer_load;
@@ -0,0 +1,9 @@
+-- загрузка ревьюверов: число открытых ревью и время последнего назначения.
+-- Одно определение для всех запросов подбора кандидатов
+CREATE VIEW reviewer_load AS
+SELECT prr.user_id,
+       COUNT(*) FILTER (WHERE pr.status = 'OPEN') AS open_reviews,
+       MAX(prr.assigned_at) AS last_assigned_at
+FROM pr_reviewers prr
+JOIN pull_requests pr ON pr.id = prr.pr_id
+GROUP BY prr.user_id;
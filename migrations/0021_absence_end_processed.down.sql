@@ -0,0 +1,2 @@
+ALTER TABLE user_absences
+    DROP COLUMN IF EXISTS end_processed_at;
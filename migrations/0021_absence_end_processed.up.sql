@@ -0,0 +1,8 @@
+-- когда фоновая задача добрала ревьюверов на PR команд пользователя после окончания отсутствия
+ALTER TABLE user_absences
+    ADD COLUMN end_processed_at TIMESTAMPTZ;
+
+-- уже закончившиеся отсутствия задним числом не обрабатываем
+UPDATE user_absences
+SET end_processed_at = ends_at
+WHERE ends_at <= NOW();
@@ -0,0 +1,2 @@
+ALTER TABLE pr_events
+    DROP COLUMN IF EXISTS actor_kind;
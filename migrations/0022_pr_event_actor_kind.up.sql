@@ -0,0 +1,11 @@
+-- кто выполнил действие: user - пользователь из X-Actor-ID (actor_id), system - сам сервис
+-- (фоновые задачи), unknown - запрос без X-Actor-ID. Прежние события без автора - unknown
+ALTER TABLE pr_events
+    ADD COLUMN actor_kind TEXT NOT NULL DEFAULT 'unknown'
+        CHECK (actor_kind IN ('user', 'system', 'unknown'));
+
+UPDATE pr_events SET actor_kind = 'user' WHERE actor_id IS NOT NULL;
+
+-- новые события указывают вид автора явно
+ALTER TABLE pr_events
+    ALTER COLUMN actor_kind DROP DEFAULT;
@@ -0,0 +1,2 @@
+ALTER TABLE pull_requests DROP COLUMN IF EXISTS merge_violations;
+ALTER TABLE pull_requests DROP COLUMN IF EXISTS merge_forced_by;
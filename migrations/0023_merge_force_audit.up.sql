@@ -0,0 +1,5 @@
+-- кто слил PR в обход политики и какие правила были нарушены; время - merged_at.
+-- у PR, слитых в обход политики до этой миграции, автор и нарушения неизвестны
+ALTER TABLE pull_requests
+    ADD COLUMN merge_forced_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN merge_violations TEXT[] NOT NULL DEFAULT '{}';
@@ -13,6 +13,70 @@ WHERE id = $1;
 SELECT * FROM teams
 WHERE name = $1;
 
+-- name: UpdateTeamSettings :one
+UPDATE teams
+SET assignment_strategy = COALESCE(sqlc.narg(assignment_strategy), assignment_strategy),
+    reviewers_count = COALESCE(sqlc.narg(reviewers_count), reviewers_count),
+    max_open_reviews = CASE WHEN sqlc.arg(set_max_open_reviews)::bool
+                            THEN sqlc.narg(max_open_reviews)
+                            ELSE max_open_reviews END,
+    require_senior = COALESCE(sqlc.narg(require_senior), require_senior),
+    juniors_not_alone = COALESCE(sqlc.narg(juniors_not_alone), juniors_not_alone),
+    min_approvals = COALESCE(sqlc.narg(min_approvals), min_approvals),
+    block_on_changes_requested = COALESCE(sqlc.narg(block_on_changes_requested), block_on_changes_requested)
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: SetTeamParent :one
+UPDATE teams
+SET parent_id = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: GetChildTeams :many
+-- подкоманды по имени
+SELECT * FROM teams
+WHERE parent_id = $1
+ORDER BY name;
+
+-- name: GetUserTeams :many
+-- команды, в которых состоит пользователь, по имени
+SELECT t.* FROM team_members tm
+JOIN teams t ON t.id = tm.team_id
+WHERE tm.user_id = $1
+ORDER BY t.name;
+
+-- name: AddTeamMember :exec
+-- добавляет участника в команду или меняет его роль в ней
+INSERT INTO team_members (team_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (team_id, user_id) DO UPDATE
+    SET role = EXCLUDED.role;
+
+-- name: GetTeamMemberRole :one
+-- роль участника в команде; нет строки - не участник
+SELECT role FROM team_members
+WHERE team_id = $1 AND user_id = $2;
+
+-- name: RemoveTeamMember :execrows
+DELETE FROM team_members
+WHERE team_id = $1 AND user_id = $2;
+
+-- name: GetTeamFallbacks :many
+-- резервные команды в порядке приоритета
+SELECT t.* FROM team_fallbacks tf
+JOIN teams t ON t.id = tf.fallback_team_id
+WHERE tf.team_id = $1
+ORDER BY tf.priority;
+
+-- name: DeleteTeamFallbacks :exec
+DELETE FROM team_fallbacks
+WHERE team_id = $1;
+
+-- name: AddTeamFallback :exec
+INSERT INTO team_fallbacks (team_id, fallback_team_id, priority)
+VALUES ($1, $2, $3);
+
 -- --- Пользователи ---
 
 -- name: CreateUser :one
@@ -29,24 +93,108 @@ UPDATE users
 SET is_active = $2
 WHERE id = $1;
 
--- name: DeactivateUsersByTeam :exec
+-- name: SetUserSkills :one
+UPDATE users
+SET skills = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserMaxOpenReviews :one
+UPDATE users
+SET max_open_reviews = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserPrimaryTeam :one
 UPDATE users
-SET is_active = false
-WHERE team_id = $1 AND is_active = true;
+SET team_id = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserSeniority :one
+UPDATE users
+SET seniority = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: DeactivateUsersByTeam :many
+-- деактивирует всю команду или только перечисленных участников (пустой список - вся команда);
+-- состоящие и в других командах остаются активными (deactivated = false)
+WITH members AS (
+    SELECT user_id FROM team_members
+    WHERE team_id = sqlc.arg(team_id)
+      AND (cardinality(sqlc.arg(user_ids)::uuid[]) = 0 OR user_id = ANY(sqlc.arg(user_ids)::uuid[]))
+), deactivated AS (
+    UPDATE users
+    SET is_active = false
+    WHERE id IN (SELECT user_id FROM members)
+      AND NOT EXISTS (
+            SELECT 1 FROM team_members o
+            WHERE o.user_id = users.id AND o.team_id <> sqlc.arg(team_id)
+      )
+    RETURNING id
+)
+SELECT m.user_id, (d.id IS NOT NULL)::bool AS deactivated
+FROM members m
+LEFT JOIN deactivated d ON d.id = m.user_id
+ORDER BY m.user_id;
 
 -- name: UpsertUser :one
+-- основная команда уже существующего пользователя не меняется: участие в других командах
+-- хранится в team_members; активность меняется, только если других команд у него нет
 INSERT INTO users (id, name, team_id, is_active)
 VALUES ($1, $2, $3, $4)
 ON CONFLICT (id) DO UPDATE
     SET
     name = EXCLUDED.name,
-    team_id = EXCLUDED.team_id,
-    is_active = EXCLUDED.is_active
+    team_id = COALESCE(users.team_id, EXCLUDED.team_id),
+    -- состоящего и в других командах их активность не касается
+    is_active = CASE WHEN EXISTS (
+                    SELECT 1 FROM team_members tm
+                    WHERE tm.user_id = users.id AND tm.team_id IS DISTINCT FROM EXCLUDED.team_id
+                ) THEN users.is_active ELSE EXCLUDED.is_active END
 RETURNING *;
 
--- name: GetUsersByTeamID :many
-SELECT * FROM users
-WHERE team_id = $1;
+-- name: GetTeamMembers :many
+-- участники команды с их ролями в ней
+SELECT users.*, tm.role
+FROM team_members tm
+JOIN users ON users.id = tm.user_id
+WHERE tm.team_id = $1
+ORDER BY users.name;
+
+-- --- Отсутствия ---
+
+-- name: CreateAbsence :one
+INSERT INTO user_absences (user_id, starts_at, ends_at, reason)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetAbsencesForUser :many
+SELECT * FROM user_absences
+WHERE user_id = $1
+ORDER BY starts_at;
+
+-- name: DeleteAbsence :execrows
+DELETE FROM user_absences
+WHERE id = $1;
+
+-- name: ClaimStartedAbsences :many
+-- помечает начавшиеся и ещё не обработанные отсутствия и возвращает их
+UPDATE user_absences
+SET processed_at = NOW()
+WHERE processed_at IS NULL
+  AND starts_at <= NOW()
+  AND ends_at > NOW()
+RETURNING *;
+
+-- name: ClaimEndedAbsences :many
+-- помечает закончившиеся и ещё не обработанные отсутствия и возвращает их
+UPDATE user_absences
+SET end_processed_at = NOW()
+WHERE end_processed_at IS NULL
+  AND ends_at <= NOW()
+RETURNING *;
 
 -- --- Пулл-реквесты ---
 
@@ -56,43 +204,150 @@ VALUES ($1, $2)
 RETURNING *;
 
 -- name: CreatePullRequestWithID :one
-INSERT INTO pull_requests (id, title, author_id)
-VALUES ($1, $2, $3)
+INSERT INTO pull_requests (id, title, author_id, required_skills, target_reviewers, team_id, status)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING *;
 
 -- name: GetPullRequest :one
 SELECT * FROM pull_requests
 WHERE id = $1;
 
+-- name: GetPullRequestForUpdate :one
+-- PR с блокировкой строки до конца транзакции: проверки и изменение статуса видят одно состояние
+SELECT * FROM pull_requests
+WHERE id = $1
+FOR UPDATE;
+
 -- name: UpdatePullRequestStatus :one
 UPDATE pull_requests
 SET status = $2, updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
+-- name: TouchPullRequest :one
+-- отмечает изменение PR, не меняя его статус (ревьюверы, решения)
+UPDATE pull_requests
+SET updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: TouchPullRequests :exec
+-- то же для набора PR (массовые переназначения и добор)
+UPDATE pull_requests
+SET updated_at = NOW()
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: MergePullRequest :one
+-- merge_forced - слияние в обход политики команды: кто слил (merge_forced_by) и что нарушено
+-- (merge_violations); сливается только открытый PR
+UPDATE pull_requests
+SET status = 'MERGED', merge_forced = $2, merge_forced_by = $3, merge_violations = $4, merged_at = COALESCE(merged_at, NOW()), updated_at = NOW()
+WHERE id = $1 AND status = 'OPEN'
+RETURNING *;
+
+-- name: GetPullRequestsWithReviewers :many
+-- автор, текущие ревьюверы с их уровнями и правила состава команды PR для набора PR
+SELECT pr.id, pr.author_id, pr.required_skills,
+       COALESCE(array_agg(prr.user_id ORDER BY prr.user_id) FILTER (WHERE prr.user_id IS NOT NULL), '{}')::uuid[] AS reviewer_ids,
+       COALESCE(array_agg(u.seniority ORDER BY prr.user_id) FILTER (WHERE prr.user_id IS NOT NULL), '{}')::text[] AS reviewer_seniorities,
+       COALESCE(t.require_senior, false)::bool AS require_senior,
+       COALESCE(t.juniors_not_alone, false)::bool AS juniors_not_alone
+FROM pull_requests pr
+LEFT JOIN pr_reviewers prr ON prr.pr_id = pr.id
+LEFT JOIN users u ON u.id = prr.user_id
+LEFT JOIN teams t ON t.id = pr.team_id
+WHERE pr.id = ANY(sqlc.arg(pr_ids)::uuid[])
+GROUP BY pr.id, t.id;
+
+-- name: SetPullRequestTargetReviewers :exec
+UPDATE pull_requests
+SET target_reviewers = $2
+WHERE id = $1;
+
+-- name: GetUnderstaffedPullRequests :many
+-- OPEN PR, у которых ревьюверов меньше целевого числа, от старых к новым, с уровнями
+-- ревьюверов и правилами состава команды PR; пустые team_ids и pr_ids - без ограничения
+SELECT pr.id, pr.title, pr.author_id, pr.required_skills, pr.target_reviewers, pr.team_id,
+       pr.created_at, pr.updated_at,
+       COALESCE(array_agg(prr.user_id ORDER BY prr.user_id) FILTER (WHERE prr.user_id IS NOT NULL), '{}')::uuid[] AS reviewer_ids,
+       COALESCE(array_agg(u.seniority ORDER BY prr.user_id) FILTER (WHERE prr.user_id IS NOT NULL), '{}')::text[] AS reviewer_seniorities,
+       COALESCE(t.require_senior, false)::bool AS require_senior,
+       COALESCE(t.juniors_not_alone, false)::bool AS juniors_not_alone
+FROM pull_requests pr
+LEFT JOIN pr_reviewers prr ON prr.pr_id = pr.id
+LEFT JOIN users u ON u.id = prr.user_id
+LEFT JOIN teams t ON t.id = pr.team_id
+WHERE pr.status = 'OPEN'
+  AND (cardinality(sqlc.arg(team_ids)::uuid[]) = 0 OR pr.team_id = ANY(sqlc.arg(team_ids)::uuid[]))
+  AND (cardinality(sqlc.arg(pr_ids)::uuid[]) = 0 OR pr.id = ANY(sqlc.arg(pr_ids)::uuid[]))
+GROUP BY pr.id, t.id
+HAVING COUNT(prr.user_id) < pr.target_reviewers
+ORDER BY pr.created_at, pr.id;
+
 -- name: GetOpenPullRequestsForReviewer :many
 SELECT pr.*
 FROM pull_requests pr
 JOIN pr_reviewers prr ON pr.id = prr.pr_id
 WHERE prr.user_id = $1 AND pr.status = 'OPEN';
 
+-- name: GetPendingPullRequestsForReviewer :many
+-- OPEN PR, по которым ревьювер ещё не принял решение (нет вердикта или только комментарии)
+SELECT pr.*
+FROM pull_requests pr
+JOIN pr_reviewers prr ON pr.id = prr.pr_id
+WHERE prr.user_id = $1 AND pr.status = 'OPEN'
+  AND (prr.verdict IS NULL OR prr.verdict = 'COMMENTED');
+
 -- --- Ревьюверы ---
 
 -- name: AddReviewerToPR :exec
-INSERT INTO pr_reviewers (pr_id, user_id)
-VALUES ($1, $2)
+-- team_id - команда, из которой взят ревьювер; NULL, если он назначен не через команду
+INSERT INTO pr_reviewers (pr_id, user_id, team_id)
+VALUES ($1, $2, $3)
 ON CONFLICT (pr_id, user_id) DO NOTHING;
 
 -- name: RemoveReviewerFromPR :exec
 DELETE FROM pr_reviewers
 WHERE pr_id = $1 AND user_id = $2;
 
+-- name: AddReviewersToPRs :exec
+-- массовое добавление назначений (pr_ids[i], user_ids[i], team_ids[i])
+INSERT INTO pr_reviewers (pr_id, user_id, team_id)
+SELECT unnest(sqlc.arg(pr_ids)::uuid[]), unnest(sqlc.arg(user_ids)::uuid[]), unnest(sqlc.arg(team_ids)::uuid[])
+ON CONFLICT (pr_id, user_id) DO NOTHING;
+
+-- name: RemoveReviewersFromOpenPRs :many
+-- снимает пользователей со всех OPEN PR и возвращает снятые назначения
+DELETE FROM pr_reviewers prr
+USING pull_requests pr
+WHERE pr.id = prr.pr_id
+  AND pr.status = 'OPEN'
+  AND prr.user_id = ANY(sqlc.arg(user_ids)::uuid[])
+RETURNING prr.pr_id, prr.user_id, prr.team_id;
+
+-- name: SetReviewVerdict :execrows
+-- сохраняет решение ревьювера; 0 строк - пользователь не назначен на PR
+UPDATE pr_reviewers
+SET verdict = $3, verdict_at = NOW()
+WHERE pr_id = $1 AND user_id = $2;
+
+-- name: GetReviewVerdicts :many
+-- решения ревьюверов PR в порядке их отправки
+SELECT user_id, verdict, verdict_at
+FROM pr_reviewers
+WHERE pr_id = $1 AND verdict IS NOT NULL
+ORDER BY verdict_at, user_id;
+
 -- name: GetReviewersForPR :many
 SELECT users.*
 FROM users
 JOIN pr_reviewers ON users.id = pr_reviewers.user_id
 WHERE pr_reviewers.pr_id = $1;
 
+-- name: GetReviewerTeam :one
+SELECT team_id FROM pr_reviewers
+WHERE pr_id = $1 AND user_id = $2;
+
 -- name: GetReviewerCountForPR :one
 SELECT count(*) FROM pr_reviewers
 WHERE pr_id = $1;
@@ -100,31 +355,254 @@ WHERE pr_id = $1;
 -- --- Кандидаты на ревью ---
 
 -- name: GetCandidatesForInitialReview :many
-SELECT * FROM users u1
-WHERE team_id = (SELECT team_id FROM users u2 WHERE u2.id = $1)
+-- все активные участники команды PR, кроме автора, с данными о загрузке; выбор делает стратегия команды
+SELECT u1.id, u1.name, u1.is_active, u1.team_id, u1.skills, u1.seniority,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       ol.last_assigned_at::timestamptz AS last_assigned_at,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM users u1
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = sqlc.arg(team_id)
+WHERE EXISTS (
+        SELECT 1 FROM team_members tm
+        WHERE tm.user_id = u1.id AND tm.team_id = sqlc.arg(team_id)
+  )
   AND u1.is_active = true
-  AND u1.id != $1
-ORDER BY random()
-LIMIT 2;
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+  )
+  AND (COALESCE(u1.max_open_reviews, t.max_open_reviews) IS NULL
+       OR COALESCE(ol.open_reviews, 0) < COALESCE(u1.max_open_reviews, t.max_open_reviews))
+  AND u1.id != sqlc.arg(author_id)
+ORDER BY u1.id;
 
 -- name: GetCandidatesForReassignment :many
-SELECT id, name, is_active, team_id FROM users u1
-WHERE team_id = (SELECT team_id FROM users u2 WHERE u2.id = $1)
+-- активные участники команды, из которой взят заменяемый ревьювер, кроме автора и текущих ревьюверов
+SELECT u1.id, u1.name, u1.is_active, u1.team_id, u1.skills, u1.seniority,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       ol.last_assigned_at::timestamptz AS last_assigned_at,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM users u1
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = sqlc.arg(team_id)
+WHERE EXISTS (
+        SELECT 1 FROM team_members tm
+        WHERE tm.user_id = u1.id AND tm.team_id = sqlc.arg(team_id)
+  )
   AND u1.is_active = true
-  AND u1.id != $1
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+  )
+  AND (COALESCE(u1.max_open_reviews, t.max_open_reviews) IS NULL
+       OR COALESCE(ol.open_reviews, 0) < COALESCE(u1.max_open_reviews, t.max_open_reviews))
+  AND u1.id != sqlc.arg(id)
+  AND u1.id != (SELECT author_id FROM pull_requests WHERE id = sqlc.arg(pr_id))
   AND u1.id NOT IN (
-        SELECT user_id FROM pr_reviewers WHERE pr_id = $2
+        SELECT user_id FROM pr_reviewers WHERE pr_id = sqlc.arg(pr_id)
   )
-LIMIT 5;
+ORDER BY u1.id;
+
+-- name: GetActiveTeamCandidates :many
+-- активные участники команды с данными о загрузке (для массового переназначения)
+SELECT u1.id, u1.name, u1.is_active, u1.team_id, u1.skills, u1.seniority,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       ol.last_assigned_at::timestamptz AS last_assigned_at,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM users u1
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = $1
+WHERE EXISTS (
+        SELECT 1 FROM team_members tm
+        WHERE tm.user_id = u1.id AND tm.team_id = $1
+  )
+  AND u1.is_active = true
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+  )
+  AND (COALESCE(u1.max_open_reviews, t.max_open_reviews) IS NULL
+       OR COALESCE(ol.open_reviews, 0) < COALESCE(u1.max_open_reviews, t.max_open_reviews))
+ORDER BY u1.id;
+
+-- name: GetActiveCandidatesByIDs :many
+-- активные пользователи из списка с данными о загрузке (владельцы кода);
+-- лимит открытых ревью - команды PR, а без неё основной команды пользователя
+SELECT u1.id, u1.name, u1.is_active, u1.team_id, u1.skills, u1.seniority,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       ol.last_assigned_at::timestamptz AS last_assigned_at,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM users u1
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = COALESCE(sqlc.narg(team_id), u1.team_id)
+WHERE u1.id = ANY(sqlc.arg(ids)::uuid[])
+  AND u1.is_active = true
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+  )
+  AND (COALESCE(u1.max_open_reviews, t.max_open_reviews) IS NULL
+       OR COALESCE(ol.open_reviews, 0) < COALESCE(u1.max_open_reviews, t.max_open_reviews))
+ORDER BY u1.id;
+
+-- name: CountCandidatesAtCapacity :one
+-- активные участники команд, пропущенные при подборе только из-за лимита открытых ревью;
+-- лимит берётся у той команды, из которой их подбирали
+SELECT COUNT(DISTINCT u1.id)
+FROM team_members tm
+JOIN users u1 ON u1.id = tm.user_id
+JOIN teams t ON t.id = tm.team_id
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+WHERE tm.team_id = ANY(sqlc.arg(team_ids)::uuid[])
+  AND u1.id <> ALL(sqlc.arg(exclude_ids)::uuid[])
+  AND u1.is_active = true
+  AND NOT EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+  )
+  AND COALESCE(ol.open_reviews, 0) >= COALESCE(u1.max_open_reviews, t.max_open_reviews);
+
+-- name: GetTeamMembersAvailability :many
+-- все участники команд с признаками доступности: объясняет, почему кандидат не может быть назначен
+SELECT tm.team_id, u1.id, u1.name, u1.is_active,
+       EXISTS (
+        SELECT 1 FROM user_absences ua
+        WHERE ua.user_id = u1.id AND ua.starts_at <= NOW() AND ua.ends_at > NOW()
+       ) AS is_absent,
+       COALESCE(ol.open_reviews, 0)::bigint AS open_reviews,
+       COALESCE(u1.max_open_reviews, t.max_open_reviews)::int AS max_open_reviews
+FROM team_members tm
+JOIN users u1 ON u1.id = tm.user_id
+LEFT JOIN reviewer_load ol ON ol.user_id = u1.id
+LEFT JOIN teams t ON t.id = tm.team_id
+WHERE tm.team_id = ANY(sqlc.arg(team_ids)::uuid[])
+ORDER BY u1.name;
+
+-- --- Владельцы кода ---
+
+-- name: GetOwnershipRules :many
+-- правила команды (repository = NULL) или репозитория (team_id = NULL) по порядку
+SELECT * FROM ownership_rules
+WHERE team_id IS NOT DISTINCT FROM sqlc.narg(team_id)
+  AND repository IS NOT DISTINCT FROM sqlc.narg(repository)
+ORDER BY position;
+
+-- name: DeleteOwnershipRules :exec
+DELETE FROM ownership_rules
+WHERE team_id IS NOT DISTINCT FROM sqlc.narg(team_id)
+  AND repository IS NOT DISTINCT FROM sqlc.narg(repository);
+
+-- name: AddOwnershipRule :exec
+INSERT INTO ownership_rules (team_id, repository, position, pattern, owner_ids)
+VALUES ($1, $2, $3, $4, $5);
 
 -- --- Статистика назначений ---
 
 -- name: GetAssignmentCountsByUser :many
-SELECT user_id, COUNT(*) AS cnt
-FROM pr_reviewers
-GROUP BY user_id;
+-- всего назначений и в разбивке по состоянию PR; у черновиков ревьюверов нет
+SELECT prr.user_id, COUNT(*) AS cnt,
+       COUNT(*) FILTER (WHERE pr.status = 'OPEN') AS open_cnt,
+       COUNT(*) FILTER (WHERE pr.status = 'MERGED') AS merged_cnt,
+       COUNT(*) FILTER (WHERE pr.status = 'CLOSED') AS closed_cnt
+FROM pr_reviewers prr
+JOIN pull_requests pr ON pr.id = prr.pr_id
+GROUP BY prr.user_id;
 
 -- name: GetAssignmentCountsByPR :many
-SELECT pr_id, COUNT(*) AS cnt
-FROM pr_reviewers
-GROUP BY pr_id;
+SELECT prr.pr_id, pr.status, COUNT(*) AS cnt
+FROM pr_reviewers prr
+JOIN pull_requests pr ON pr.id = prr.pr_id
+GROUP BY prr.pr_id, pr.status;
+
+-- --- История пар автор -> ревьювер ---
+
+-- name: GetRecentPairCounts :many
+-- сколько раз с момента since каждый ревьювер назначался на PR каждого из авторов;
+-- по истории назначений, поэтому учитываются и снятые, и заменённые ревьюверы
+SELECT pr.author_id, pa.user_id AS reviewer_id, COUNT(*) AS pairs
+FROM pr_assignments pa
+JOIN pull_requests pr ON pr.id = pa.pr_id
+WHERE pr.author_id = ANY(sqlc.arg(author_ids)::uuid[])
+  AND pa.assigned_at >= sqlc.arg(since)
+GROUP BY pr.author_id, pa.user_id;
+
+-- name: GetPairCountsByTeam :many
+-- матрица пар автор -> ревьювер с момента since, сгруппированная по команде PR
+SELECT t.name AS team_name, pr.author_id, pa.user_id AS reviewer_id, COUNT(*) AS pairs
+FROM pr_assignments pa
+JOIN pull_requests pr ON pr.id = pa.pr_id
+JOIN teams t ON t.id = pr.team_id
+WHERE pa.assigned_at >= sqlc.arg(since)
+GROUP BY t.name, pr.author_id, pa.user_id
+ORDER BY t.name, pr.author_id, pa.user_id;
+
+-- --- Причины назначений ---
+
+-- name: RecordAssignments :exec
+-- записывает назначения (pr_ids[i], user_ids[i], ...); нулевой uuid и пустая строка - NULL
+INSERT INTO pr_assignments (pr_id, user_id, reason, replaced_user_id, team_id, strategy, inputs)
+SELECT a.pr_id, a.user_id, a.reason,
+       NULLIF(a.replaced_user_id, '00000000-0000-0000-0000-000000000000'),
+       NULLIF(a.team_id, '00000000-0000-0000-0000-000000000000'),
+       NULLIF(a.strategy, ''),
+       a.inputs
+FROM unnest(
+    sqlc.arg(pr_ids)::uuid[],
+    sqlc.arg(user_ids)::uuid[],
+    sqlc.arg(reasons)::text[],
+    sqlc.arg(replaced_user_ids)::uuid[],
+    sqlc.arg(team_ids)::uuid[],
+    sqlc.arg(strategies)::text[],
+    sqlc.arg(inputs)::jsonb[]
+) AS a(pr_id, user_id, reason, replaced_user_id, team_id, strategy, inputs);
+
+-- name: CloseAssignments :exec
+-- отмечает снятие ревьюверов (pr_ids[i], user_ids[i]) в истории назначений
+UPDATE pr_assignments a
+SET removed_at = NOW()
+FROM unnest(sqlc.arg(pr_ids)::uuid[], sqlc.arg(user_ids)::uuid[]) AS r(pr_id, user_id)
+WHERE a.pr_id = r.pr_id
+  AND a.user_id = r.user_id
+  AND a.removed_at IS NULL;
+
+-- name: GetAssignmentsForPR :many
+-- история назначений PR вместе с названием команды, из которой взят ревьювер
+SELECT a.user_id, a.reason, a.replaced_user_id, t.name AS team_name, a.strategy, a.inputs,
+       a.assigned_at, a.removed_at
+FROM pr_assignments a
+LEFT JOIN teams t ON t.id = a.team_id
+WHERE a.pr_id = $1
+ORDER BY a.assigned_at, a.user_id;
+
+-- --- События PR ---
+
+-- name: RecordPREvents :exec
+-- добавляет события (pr_ids[i], event_types[i], ...); нулевой uuid и пустая строка - NULL
+INSERT INTO pr_events (pr_id, event_type, actor_id, actor_kind, user_id, replaced_user_id, from_status, to_status, details)
+SELECT e.pr_id, e.event_type,
+       NULLIF(e.actor_id, '00000000-0000-0000-0000-000000000000'),
+       e.actor_kind,
+       NULLIF(e.user_id, '00000000-0000-0000-0000-000000000000'),
+       NULLIF(e.replaced_user_id, '00000000-0000-0000-0000-000000000000'),
+       NULLIF(e.from_status, ''),
+       NULLIF(e.to_status, ''),
+       e.details
+FROM unnest(
+    sqlc.arg(pr_ids)::uuid[],
+    sqlc.arg(event_types)::text[],
+    sqlc.arg(actor_ids)::uuid[],
+    sqlc.arg(actor_kinds)::text[],
+    sqlc.arg(user_ids)::uuid[],
+    sqlc.arg(replaced_user_ids)::uuid[],
+    sqlc.arg(from_statuses)::text[],
+    sqlc.arg(to_statuses)::text[],
+    sqlc.arg(details)::jsonb[]
+) WITH ORDINALITY AS e(pr_id, event_type, actor_id, actor_kind, user_id, replaced_user_id, from_status, to_status, details, ord)
+ORDER BY e.ord;
+
+-- name: GetPREvents :many
+-- лента событий PR в порядке записи
+SELECT * FROM pr_events
+WHERE pr_id = $1
+ORDER BY created_at, id;